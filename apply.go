@@ -11,6 +11,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 var openFile = os.OpenFile
@@ -48,72 +49,102 @@ func Apply(update io.Reader, opts Options) error {
 }
 
 func apply(update io.Reader, opts *Options) error {
+	if err := opts.prepare(); err != nil {
+		return newApplyError(StagePrepare, err)
+	}
+
+	newBytes, err := opts.readUpdate(update)
+	if err != nil {
+		return newApplyError(StageRead, err)
+	}
+
+	size := int64(len(newBytes))
+	opts.reporter.report(PhaseVerify, 0, size, nil)
+	if err = opts.verify(newBytes); err != nil {
+		opts.reporter.report(PhaseVerify, 0, size, err)
+		return newApplyError(StageVerify, err)
+	}
+	opts.reporter.report(PhaseVerify, size, size, nil)
+
+	opts.reporter.report(PhaseInstall, 0, size, nil)
+	if err = opts.install(newBytes); err != nil {
+		opts.reporter.report(PhaseInstall, 0, size, err)
+		return newApplyError(StageInstall, err)
+	}
+	opts.reporter.report(PhaseInstall, size, size, nil)
+	return nil
+}
+
+// prepare validates the options and set their defaults
+func (o *Options) prepare() error {
 	// validate
-	verify := false
 	switch {
-	case opts.Signature != nil && opts.PublicKey != nil:
+	case o.Signature != nil && o.PublicKey != nil:
 		// okay
-		verify = true
-	case opts.Signature != nil:
-		return errors.New("no public key to verify signature with")
-	case opts.PublicKey != nil:
-		return errors.New("no signature to verify with")
+	case o.Signature != nil:
+		return fmt.Errorf("%w: no public key to verify signature with", ErrInvalidPublicKey)
+	case o.PublicKey != nil:
+		return fmt.Errorf("%w: no signature to verify with", ErrSignatureMalformed)
 	}
 
 	// set defaults
-	if opts.Hash == 0 {
-		opts.Hash = crypto.SHA256
+	if o.Hash == 0 {
+		o.Hash = crypto.SHA256
+	}
+	if o.Verifier == nil {
+		o.Verifier = NewECDSAVerifier()
 	}
-	if opts.Verifier == nil {
-		opts.Verifier = NewECDSAVerifier()
+	if o.TargetMode == 0 {
+		o.TargetMode = 0755
 	}
-	if opts.TargetMode == 0 {
-		opts.TargetMode = 0755
+	if o.ProgressInfoCallback != nil && o.reporter == nil {
+		o.reporter = &progressReporter{callback: o.ProgressInfoCallback, interval: DefaultProgressInterval, now: time.Now}
 	}
 
 	// get target path
 	var err error
-	opts.TargetPath, err = opts.getPath()
-	if err != nil {
-		return err
-	}
+	o.TargetPath, err = o.getPath()
+	return err
+}
 
-	var newBytes []byte
-	if opts.Patcher != nil {
-		if newBytes, err = opts.applyPatch(update); err != nil {
-			return err
-		}
-	} else {
-		// no patch to apply, go on through
-		if newBytes, err = io.ReadAll(update); err != nil {
-			return err
-		}
+// readUpdate returns the content of the new executable, applying the patch if necessary
+func (o *Options) readUpdate(update io.Reader) ([]byte, error) {
+	if o.Patcher != nil {
+		return o.applyPatch(update)
 	}
+	// no patch to apply, go on through
+	return io.ReadAll(update)
+}
 
-	// verify checksum if requested
-	if opts.Checksum != nil {
-		if err = opts.verifyChecksum(newBytes); err != nil {
+// verify checks the checksum and the signature of the new executable if requested
+func (o *Options) verify(newBytes []byte) error {
+	if o.Checksum != nil {
+		if err := o.verifyChecksum(newBytes); err != nil {
 			return err
 		}
 	}
 
-	if verify {
-		if err = opts.verifySignature(newBytes); err != nil {
+	if o.Signature != nil && o.PublicKey != nil {
+		if err := o.verifySignature(newBytes); err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
+// install swaps the new executable in place of the target
+func (o *Options) install(newBytes []byte) error {
 	// get the directory the executable exists in
-	updateDir := filepath.Dir(opts.TargetPath)
-	filename := filepath.Base(opts.TargetPath)
+	updateDir := filepath.Dir(o.TargetPath)
+	filename := filepath.Base(o.TargetPath)
 
 	// Copy the contents of newbinary to a new executable file
 	newPath := filepath.Join(updateDir, fmt.Sprintf(".%s.new", filename))
-	fp, err := openFile(newPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, opts.TargetMode)
+	fp, err := openFile(newPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, o.TargetMode)
 	if err != nil {
 		return err
 	}
-	os.Chmod(newPath, opts.TargetMode)
+	os.Chmod(newPath, o.TargetMode)
 	defer fp.Close()
 
 	_, err = io.Copy(fp, bytes.NewReader(newBytes))
@@ -127,8 +158,8 @@ func apply(update io.Reader, opts *Options) error {
 	fp.Close()
 
 	// this is where we'll move the executable to so that we can swap in the updated replacement
-	oldPath := opts.OldSavePath
-	removeOld := opts.OldSavePath == ""
+	oldPath := o.OldSavePath
+	removeOld := o.OldSavePath == ""
 	if removeOld {
 		oldPath = filepath.Join(updateDir, fmt.Sprintf(".%s.old", filename))
 	}
@@ -139,13 +170,13 @@ func apply(update io.Reader, opts *Options) error {
 	_ = os.Remove(oldPath)
 
 	// move the existing executable to a new file in the same directory
-	err = os.Rename(opts.TargetPath, oldPath)
+	err = os.Rename(o.TargetPath, oldPath)
 	if err != nil {
 		return err
 	}
 
 	// move the new exectuable in to become the new program
-	err = os.Rename(newPath, opts.TargetPath)
+	err = os.Rename(newPath, o.TargetPath)
 
 	if err != nil {
 		// move unsuccessful
@@ -155,12 +186,9 @@ func apply(update io.Reader, opts *Options) error {
 		// binary to take its place. That means there is no file where the current executable binary
 		// used to be!
 		// Try to rollback by restoring the old binary to its original path.
-		rerr := os.Rename(oldPath, opts.TargetPath)
-		if rerr != nil {
-			return &rollbackErr{err, rerr}
-		}
-
-		return err
+		rerr := os.Rename(oldPath, o.TargetPath)
+		// a successful rollback is reported with a nil rollbackErr so that RollbackError returns nil
+		return &rollbackErr{err, rerr}
 	}
 
 	// move successful, remove the old binary if needed
@@ -186,7 +214,8 @@ func RollbackError(err error) error {
 	if err == nil {
 		return nil
 	}
-	if rerr, ok := err.(*rollbackErr); ok {
+	var rerr *rollbackErr
+	if errors.As(err, &rerr) {
 		return rerr.rollbackErr
 	}
 	return nil
@@ -197,6 +226,11 @@ type rollbackErr struct {
 	rollbackErr error // error encountered while rolling back
 }
 
+// Unwrap returns the original error
+func (r *rollbackErr) Unwrap() error {
+	return r.error
+}
+
 // Options give additional parameters when calling Apply
 type Options struct {
 	// TargetPath defines the path to the file to update.
@@ -228,6 +262,12 @@ type Options struct {
 	// Store the old executable file at this path after a successful update.
 	// The empty string means the old executable file will be removed after the update.
 	OldSavePath string
+
+	// If present, called back with the progress of the patch, verify and install phases.
+	// The download is not reported as the update is only known as an io.Reader.
+	ProgressInfoCallback func(Progress, error)
+
+	reporter *progressReporter
 }
 
 // CheckPermissions determines whether the process has the correct permissions to
@@ -261,7 +301,7 @@ func (o *Options) CheckPermissions() error {
 func (o *Options) SetPublicKeyPEM(pembytes []byte) error {
 	block, _ := pem.Decode(pembytes)
 	if block == nil {
-		return errors.New("couldn't parse PEM data")
+		return fmt.Errorf("%w: couldn't parse PEM data", ErrInvalidPublicKey)
 	}
 
 	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
@@ -280,6 +320,12 @@ func (o *Options) getPath() (string, error) {
 }
 
 func (o *Options) applyPatch(patch io.Reader) ([]byte, error) {
+	// read the whole patch first, so that reading it is not reported as part of the patch phase
+	patchBytes, err := io.ReadAll(patch)
+	if err != nil {
+		return nil, err
+	}
+
 	// open the file to patch
 	old, err := os.Open(o.TargetPath)
 	if err != nil {
@@ -287,11 +333,15 @@ func (o *Options) applyPatch(patch io.Reader) ([]byte, error) {
 	}
 	defer old.Close()
 
-	// apply the patch
+	// apply the patch, the size of the result is only known once done
+	o.reporter.report(PhasePatch, 0, -1, nil)
 	var applied bytes.Buffer
-	if err = o.Patcher.Patch(old, &applied, patch); err != nil {
+	if err = o.Patcher.Patch(old, &applied, bytes.NewReader(patchBytes)); err != nil {
+		o.reporter.report(PhasePatch, 0, -1, err)
 		return nil, err
 	}
+	size := int64(applied.Len())
+	o.reporter.report(PhasePatch, size, size, nil)
 
 	return applied.Bytes(), nil
 }
@@ -303,7 +353,7 @@ func (o *Options) verifyChecksum(updated []byte) error {
 	}
 
 	if !bytes.Equal(o.Checksum, checksum) {
-		return fmt.Errorf("updated file has wrong checksum. Expected: %x, got: %x", o.Checksum, checksum)
+		return fmt.Errorf("%w: updated file has wrong checksum. Expected: %x, got: %x", ErrChecksumMismatch, o.Checksum, checksum)
 	}
 	return nil
 }
@@ -312,7 +362,7 @@ func (o *Options) verifySignature(updated []byte) error {
 	if publicKey, ok := o.PublicKey.(ed25519.PublicKey); ok {
 		valid := ed25519.Verify(publicKey, updated, o.Signature)
 		if !valid {
-			return errors.New("invalid ed25519 signature")
+			return fmt.Errorf("%w: ed25519 verification failed", ErrSignatureInvalid)
 		}
 		return nil
 	}
@@ -320,12 +370,17 @@ func (o *Options) verifySignature(updated []byte) error {
 	if err != nil {
 		return err
 	}
-	return o.Verifier.VerifySignature(checksum, o.Signature, o.Hash, o.PublicKey)
+	err = o.Verifier.VerifySignature(checksum, o.Signature, o.Hash, o.PublicKey)
+	if err != nil && !errors.Is(err, ErrSignatureInvalid) && !errors.Is(err, ErrSignatureMalformed) && !errors.Is(err, ErrInvalidPublicKey) {
+		// any other failure of a Verifier means the signature does not match
+		return fmt.Errorf("%w: %w", ErrSignatureInvalid, err)
+	}
+	return err
 }
 
 func checksumFor(h crypto.Hash, payload []byte) ([]byte, error) {
 	if !h.Available() {
-		return nil, errors.New("requested hash function not available")
+		return nil, ErrHashUnavailable
 	}
 	hash := h.New()
 	hash.Write(payload) // guaranteed not to error
@@ -8,6 +8,7 @@ import (
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"os"
 	"testing"
@@ -104,6 +105,10 @@ func TestVerifyChecksumNegative(t *testing.T) {
 	if err == nil {
 		t.Fatalf("Failed to detect bad checksum!")
 	}
+	var applyErr *ApplyError
+	if !errors.Is(err, ErrChecksumMismatch) || !errors.As(err, &applyErr) || applyErr.Stage != StageVerify {
+		t.Fatalf("Bad checksum reported with an unexpected error: %v", err)
+	}
 }
 
 func TestApplyPatch(t *testing.T) {
@@ -124,6 +129,47 @@ func TestApplyPatch(t *testing.T) {
 	validateUpdate(fName, err, t)
 }
 
+func TestApplyPatchProgress(t *testing.T) {
+	fName := "TestApplyPatchProgress"
+	defer cleanup(fName)
+	writeOldFile(fName, t)
+
+	patch := new(bytes.Buffer)
+	err := binarydist.Diff(bytes.NewReader(oldFile), bytes.NewReader(newFile), patch)
+	if err != nil {
+		t.Fatalf("Failed to create patch: %v", err)
+	}
+
+	var reports []Progress
+	err = Apply(patch, Options{
+		TargetPath:           fName,
+		Patcher:              NewBSDiffPatcher(),
+		ProgressInfoCallback: func(p Progress, err error) { reports = append(reports, p) },
+	})
+	validateUpdate(fName, err, t)
+
+	size := int64(len(newFile))
+	expected := []Progress{
+		{Phase: PhasePatch, Done: 0, Total: -1},
+		{Phase: PhasePatch, Done: size, Total: size},
+		{Phase: PhaseVerify, Done: 0, Total: size},
+		{Phase: PhaseVerify, Done: size, Total: size},
+		{Phase: PhaseInstall, Done: 0, Total: size},
+		{Phase: PhaseInstall, Done: size, Total: size},
+	}
+	if len(reports) != len(expected) {
+		t.Fatalf("Unexpected progress reports: %+v", reports)
+	}
+	for i, p := range reports {
+		if p.Phase != expected[i].Phase || p.Done != expected[i].Done || p.Total != expected[i].Total {
+			t.Fatalf("Unexpected progress report %d: %+v, expected %+v", i, p, expected[i])
+		}
+	}
+	if PhasePatch.String() != "patch" || PhaseDecompress.String() != "decompress" {
+		t.Fatalf("Unexpected phase names %s and %s", PhasePatch, PhaseDecompress)
+	}
+}
+
 func TestCorruptPatch(t *testing.T) {
 	fName := "TestCorruptPatch"
 	defer cleanup(fName)
@@ -418,6 +464,9 @@ func TestVerifyFailWrongSignature(t *testing.T) {
 	if err == nil {
 		t.Fatalf("Verified an update that was signed by an untrusted key!")
 	}
+	if !errors.Is(err, ErrSignatureInvalid) {
+		t.Fatalf("Untrusted signature reported with an unexpected error: %v", err)
+	}
 }
 
 func TestVerifyFailWrongEd25519Signature(t *testing.T) {
@@ -436,6 +485,9 @@ func TestVerifyFailWrongEd25519Signature(t *testing.T) {
 	if err == nil {
 		t.Fatalf("Verified an update that was signed by an untrusted key!")
 	}
+	if !errors.Is(err, ErrSignatureInvalid) {
+		t.Fatalf("Untrusted signature reported with an unexpected error: %v", err)
+	}
 }
 
 func TestSignatureButNoPublicKey(t *testing.T) {
@@ -465,6 +517,10 @@ func TestPublicKeyButNoSignature(t *testing.T) {
 	if err == nil {
 		t.Fatalf("Allowed an update with no signautre when a public key was specified!")
 	}
+	var applyErr *ApplyError
+	if !errors.As(err, &applyErr) || applyErr.Stage != StagePrepare {
+		t.Fatalf("Missing signature reported with an unexpected error: %v", err)
+	}
 }
 
 func TestWriteError(t *testing.T) {
@@ -1,82 +1,322 @@
 package selfupdate
 
 import (
-	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"hash"
 	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
+// AWSSource provide a Source that will download the update from an AWS S3 bucket.
+// It is expecting the signature file to be stored at ${key}.ed25519
 type AWSSource struct {
-	client *s3.Client
-	bucket string
-	key    string
+	client  *s3.Client
+	bucket  string
+	key     string
+	pointer string
+
+	lock     sync.Mutex
+	resolved string
 }
 
 var _ Source = (*AWSSource)(nil)
 
-func NewAWSSource(client *s3.Client, bucket string, base string) Source {
+// ReleasePointer designate the current release of a versioned layout, where each release is
+// stored under its own immutable prefix, like releases/v1.2.3/, so that a previous release
+// can be restored by updating the pointer.
+type ReleasePointer struct {
+	Version  string    `json:"version"`            // Version number of the release
+	Path     string    `json:"path"`               // Key prefix of the release, ending with a slash
+	Date     time.Time `json:"date"`               // When the pointer was updated
+	Rollback bool      `json:"rollback,omitempty"` // Set when the pointer was moved back to a previous release, that clients on a newer version then install
+}
+
+// AWSSourceOption configure an AWSSource
+type AWSSourceOption func(*AWSSource)
+
+// WithAWSReleasePointer resolve the executable through the ReleasePointer stored as JSON at the
+// specified key, the base given to NewAWSSource being then relative to the path of the release
+func WithAWSReleasePointer(key string) AWSSourceOption {
+	return func(s *AWSSource) {
+		s.pointer = key
+	}
+}
+
+// NewAWSSource provide a selfupdate.Source that will read the object named after the base in the
+// bucket, using the s3.Client provided. The base is a Go Template string that recognize the same
+// parameters as NewHTTPSource.
+func NewAWSSource(client *s3.Client, bucket string, base string, opts ...AWSSourceOption) Source {
 	key := replaceURLTemplate(base)
-	return &AWSSource{client: client, bucket: bucket, key: key}
+	s := &AWSSource{client: client, bucket: bucket, key: key}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-// Get will return if it succeed an io.ReaderCloser to the new executable being downloaded and its length
+// Get will return if it succeed an io.ReaderCloser to the new executable being downloaded and its length.
+// The request is conditional to the ETag of the current version and, unless a release pointer is
+// used, to its date, a 304 Not Modified being reported as ErrNoUpdate. An interrupted download is
+// resumed with a ranged request and the SHA-256 checksum stored by S3, if any, is verified.
 func (s *AWSSource) Get(v *Version) (io.ReadCloser, int64, error) {
-	obj, err := s.client.GetObject(context.Background(), &s3.GetObjectInput{
-		Bucket: aws.String(s.bucket),
-		Key:    aws.String(s.key),
-	})
+	key, err := s.resolvedKey()
 	if err != nil {
 		return nil, 0, err
 	}
 
-	return obj.Body, aws.ToInt64(obj.ContentLength), nil
+	input := &s3.GetObjectInput{
+		Bucket:       aws.String(s.bucket),
+		Key:          aws.String(key),
+		ChecksumMode: types.ChecksumModeEnabled,
+	}
+	if v != nil {
+		if v.ETag != "" {
+			input.IfNoneMatch = aws.String(v.ETag)
+		}
+		// the date of a release pointer is not the one of the object
+		if !v.Date.IsZero() && s.pointer == "" {
+			input.IfModifiedSince = aws.Time(v.Date)
+		}
+	}
+
+	obj, err := s.client.GetObject(context.Background(), input)
+	if err != nil {
+		return nil, 0, s.sourceError("get", key, err)
+	}
+
+	d := &s3Download{
+		source: s,
+		key:    key,
+		etag:   aws.ToString(obj.ETag),
+		body:   obj.Body,
+		size:   aws.ToInt64(obj.ContentLength),
+		hash:   sha256.New(),
+	}
+	// the checksum of a multipart upload is a checksum of the checksums of the parts
+	if checksum := aws.ToString(obj.ChecksumSHA256); !strings.Contains(checksum, "-") {
+		d.checksum = checksum
+	}
+	return d, d.size, nil
 }
 
 // GetSignature will return the content of ${URL}.ed25519
 func (s *AWSSource) GetSignature() ([64]byte, error) {
+	key, err := s.resolvedKey()
+	if err != nil {
+		return [64]byte{}, err
+	}
+
 	obj, err := s.client.GetObject(context.Background(), &s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
-		Key:    aws.String(s.key + ".ed25519"),
+		Key:    aws.String(key + ".ed25519"),
 	})
 	if err != nil {
-		return [64]byte{}, err
+		return [64]byte{}, newSourceError("get signature", s.location(key+".ed25519"), err)
 	}
 	defer obj.Body.Close()
 
-	size := aws.ToInt64(obj.ContentLength)
-	if size != 64 {
-		return [64]byte{}, fmt.Errorf("ed25519 signature must be 64 bytes long and was %v", size)
+	r, err := readSignature(obj.Body, aws.ToInt64(obj.ContentLength))
+	if err != nil {
+		return [64]byte{}, newSourceError("get signature", s.location(key+".ed25519"), err)
 	}
+	return r, nil
+}
 
-	writer := bytes.NewBuffer(make([]byte, 0, 64))
-	n, err := io.Copy(writer, obj.Body)
+// LatestVersion will return the LastModified time, the ETag and the size of the executable, along
+// with the version, build and critical flag stored in its metadata by selfupdatectl aws-upload.
+// The version and date of the release pointer take precedence if one is used, and a rollback
+// it designate is reported in the Rollback field.
+func (s *AWSSource) LatestVersion() (*Version, error) {
+	release, key, err := s.resolve()
 	if err != nil {
-		return [64]byte{}, err
+		return nil, err
 	}
 
-	if n != 64 {
-		return [64]byte{}, fmt.Errorf("ed25519 signature must be 64 bytes long and was %v", n)
+	info, err := s.client.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, newSourceError("latest version", s.location(key), err)
 	}
 
-	r := [64]byte{}
-	copy(r[:], writer.Bytes())
+	v := &Version{
+		Date: aws.ToTime(info.LastModified),
+		Size: aws.ToInt64(info.ContentLength),
+		ETag: aws.ToString(info.ETag),
+	}
+	metadataVersion(v, info.Metadata)
+	if release != nil {
+		v.Number, v.Date, v.Rollback = release.Version, release.Date, release.Rollback
+	}
+	return v, nil
+}
 
-	return r, nil
+// resolvedKey return the key of the executable found by the last LatestVersion, resolving it if needed
+func (s *AWSSource) resolvedKey() (string, error) {
+	s.lock.Lock()
+	key := s.resolved
+	s.lock.Unlock()
+
+	if key != "" {
+		return key, nil
+	}
+
+	_, key, err := s.resolve()
+	return key, err
 }
 
-// LatestVersion will return the LastModified time
-func (s *AWSSource) LatestVersion() (*Version, error) {
-	info, err := s.client.HeadObject(context.Background(), &s3.HeadObjectInput{
+// resolve read the release pointer if one is used and return the key of the executable
+func (s *AWSSource) resolve() (*ReleasePointer, string, error) {
+	if s.pointer == "" {
+		return nil, s.key, nil
+	}
+
+	obj, err := s.client.GetObject(context.Background(), &s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
-		Key:    aws.String(s.key),
+		Key:    aws.String(s.pointer),
 	})
 	if err != nil {
-		return nil, err
+		return nil, "", newSourceError("latest version", s.location(s.pointer), err)
+	}
+	defer obj.Body.Close()
+
+	release := &ReleasePointer{}
+	if err := json.NewDecoder(obj.Body).Decode(release); err != nil {
+		return nil, "", newSourceError("latest version", s.location(s.pointer), fmt.Errorf("%w: invalid release pointer: %w", ErrNoVersion, err))
+	}
+	if release.Path == "" {
+		return nil, "", newSourceError("latest version", s.location(s.pointer), fmt.Errorf("%w: release pointer without path", ErrNoVersion))
+	}
+
+	key := release.Path + s.key
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.resolved = key
+	return release, key, nil
+}
+
+// metadataVersion fill the version with the user metadata of the object, which S3 return lower cased
+func metadataVersion(v *Version, metadata map[string]string) {
+	v.Number = metadata["version"]
+	if build, err := strconv.Atoi(metadata["build"]); err == nil {
+		v.Build = build
+	}
+	if critical, err := strconv.ParseBool(metadata["critical"]); err == nil {
+		v.Critical = critical
+	}
+}
+
+// sourceError wrap an SDK error in a SourceError, a 304 Not Modified being reported as ErrNoUpdate
+func (s *AWSSource) sourceError(op string, key string, err error) error {
+	se := newSourceError(op, s.location(key), err).(*SourceError)
+	if se.StatusCode == http.StatusNotModified {
+		se.Err = ErrNoUpdate
 	}
+	return se
+}
 
-	return &Version{Date: aws.ToTime(info.LastModified)}, nil
+func (s *AWSSource) location(key string) string {
+	return "s3://" + s.bucket + "/" + key
+}
+
+// awsResumeAttempts is the number of times an interrupted download is resumed without progress
+const awsResumeAttempts = 3
+
+// s3Download read an object, resuming the download where it was interrupted with a ranged
+// request conditional to the ETag, and verify the SHA-256 checksum of the whole object. The
+// offset and ETag only live as long as the download: what was read before a restart is not
+// kept, so there would be nothing to resume from.
+type s3Download struct {
+	source   *AWSSource
+	key      string
+	etag     string
+	checksum string
+
+	body     io.ReadCloser
+	offset   int64
+	size     int64
+	hash     hash.Hash
+	attempts int
+}
+
+func (d *s3Download) Read(p []byte) (int, error) {
+	if d.body == nil {
+		if err := d.resume(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := d.body.Read(p)
+	d.offset += int64(n)
+	d.hash.Write(p[:n])
+	if n > 0 {
+		d.attempts = 0
+	}
+
+	switch {
+	case err == nil:
+		return n, nil
+	case d.size <= 0 || d.offset >= d.size:
+		return n, d.verify(err)
+	case d.attempts >= awsResumeAttempts:
+		return n, newSourceError("get", d.source.location(d.key), err)
+	}
+
+	d.body.Close()
+	d.body = nil
+	d.attempts++
+	return n, nil
+}
+
+func (d *s3Download) Close() error {
+	if d.body == nil {
+		return nil
+	}
+	return d.body.Close()
+}
+
+// resume request the rest of the object, making sure it did not change in between
+func (d *s3Download) resume() error {
+	obj, err := d.source.client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket:  aws.String(d.source.bucket),
+		Key:     aws.String(d.key),
+		Range:   aws.String(fmt.Sprintf("bytes=%d-", d.offset)),
+		IfMatch: aws.String(d.etag),
+	})
+	if err != nil {
+		return d.source.sourceError("get", d.key, err)
+	}
+
+	d.body = obj.Body
+	if aws.ToString(obj.ContentRange) == "" {
+		// the whole object was sent again
+		if _, err := io.CopyN(io.Discard, d.body, d.offset); err != nil {
+			return newSourceError("get", d.source.location(d.key), err)
+		}
+	}
+	return nil
+}
+
+// verify the checksum once the whole object is read, the error of the last read is returned if it matches
+func (d *s3Download) verify(err error) error {
+	if d.checksum != "" && d.checksum != base64.StdEncoding.EncodeToString(d.hash.Sum(nil)) {
+		return newSourceError("get", d.source.location(d.key), fmt.Errorf("%w: sha256 of the object is not %s", ErrChecksumMismatch, d.checksum))
+	}
+	if err == io.EOF {
+		return err
+	}
+	return newSourceError("get", d.source.location(d.key), err)
 }
@@ -0,0 +1,238 @@
+package selfupdate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 serves the objects of a single bucket with path style requests, like MinIO
+type fakeS3 struct {
+	lock      sync.Mutex
+	objects   map[string][]byte
+	metadata  map[string]map[string]string // user metadata of the objects
+	checksums map[string]string            // SHA-256 checksum to serve instead of the one of the content
+	cutAfter  int                          // if positive, the next full download is interrupted after that many bytes
+	ranges    []string                     // Range header of the requests received
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request, bucket string) {
+	f.lock.Lock()
+	key := strings.TrimPrefix(r.URL.Path, "/"+bucket+"/")
+	content, ok := f.objects[key]
+	metadata := f.metadata[key]
+	checksum, forged := f.checksums[key]
+	cutAfter := 0
+	if r.Method == http.MethodGet && r.Header.Get("Range") == "" {
+		cutAfter, f.cutAfter = f.cutAfter, 0
+	}
+	f.ranges = append(f.ranges, r.Header.Get("Range"))
+	f.lock.Unlock()
+
+	if !ok {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+		return
+	}
+
+	sum := sha256.Sum256(content)
+	if !forged {
+		checksum = base64.StdEncoding.EncodeToString(sum[:])
+	}
+	w.Header().Set("ETag", fmt.Sprintf(`"%x"`, sum[:8]))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if r.Header.Get("X-Amz-Checksum-Mode") == "ENABLED" {
+		w.Header().Set("X-Amz-Checksum-Sha256", checksum)
+	}
+	for k, v := range metadata {
+		w.Header().Set("X-Amz-Meta-"+k, v)
+	}
+
+	if cutAfter > 0 {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Header().Set("Last-Modified", s3LastModified.Format(http.TimeFormat))
+		w.Write(content[:cutAfter])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	http.ServeContent(w, r, key, s3LastModified, bytes.NewReader(content))
+}
+
+var s3LastModified = time.Date(2022, 6, 22, 10, 0, 0, 0, time.UTC)
+
+func s3Server(t *testing.T, bucket string, objects map[string][]byte) (*fakeS3, *s3.Client) {
+	fake := &fakeS3{objects: objects, metadata: map[string]map[string]string{}, checksums: map[string]string{}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fake.ServeHTTP(w, r, bucket)
+	}))
+	t.Cleanup(server.Close)
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials:  credentials.NewStaticCredentialsProvider("access", "secret", ""),
+	})
+	return fake, client
+}
+
+func TestAWSSource(t *testing.T) {
+	_, client := s3Server(t, "releases", map[string][]byte{
+		"app-" + runtime.GOOS:              newFile,
+		"app-" + runtime.GOOS + ".ed25519": make([]byte, 64),
+	})
+
+	source := NewAWSSource(client, "releases", "app-{{.OS}}")
+	version, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2022, 6, 22, 10, 0, 0, 0, time.UTC), version.Date)
+	assert.Equal(t, int64(len(newFile)), version.Size)
+
+	signature, err := source.GetSignature()
+	assert.Nil(t, err)
+	assert.Equal(t, [64]byte{}, signature)
+
+	r, size, err := source.Get(&Version{})
+	assert.Nil(t, err)
+	content, err := io.ReadAll(r)
+	r.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, content)
+	assert.Equal(t, int64(len(newFile)), size)
+}
+
+func TestAWSSourceReleasePointer(t *testing.T) {
+	objects := map[string][]byte{
+		"app/latest.json":                             []byte(`{"version": "1.2.0", "path": "app/v1.2.0/", "date": "2022-06-23T10:00:00Z"}`),
+		"app/v1.1.0/app-" + runtime.GOOS:              oldFile,
+		"app/v1.1.0/app-" + runtime.GOOS + ".ed25519": make([]byte, 64),
+		"app/v1.2.0/app-" + runtime.GOOS:              newFile,
+		"app/v1.2.0/app-" + runtime.GOOS + ".ed25519": make([]byte, 64),
+	}
+	fake, client := s3Server(t, "releases", objects)
+
+	source := NewAWSSource(client, "releases", "app-{{.OS}}", WithAWSReleasePointer("app/latest.json"))
+	version, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.0", version.Number)
+	assert.Equal(t, time.Date(2022, 6, 23, 10, 0, 0, 0, time.UTC), version.Date)
+	assert.Equal(t, int64(len(newFile)), version.Size)
+
+	r, _, err := source.Get(&Version{})
+	assert.Nil(t, err)
+	content, _ := io.ReadAll(r)
+	r.Close()
+	assert.Equal(t, newFile, content)
+
+	// rollback
+	fake.lock.Lock()
+	objects["app/latest.json"] = []byte(`{"version": "1.1.0", "path": "app/v1.1.0/", "date": "2022-06-24T10:00:00Z", "rollback": true}`)
+	fake.lock.Unlock()
+	version, err = source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.1.0", version.Number)
+	assert.True(t, version.Rollback)
+	r, _, err = source.Get(&Version{})
+	assert.Nil(t, err)
+	content, _ = io.ReadAll(r)
+	r.Close()
+	assert.Equal(t, oldFile, content)
+
+	_, err = NewAWSSource(client, "releases", "app", WithAWSReleasePointer("missing.json")).LatestVersion()
+	var se *SourceError
+	assert.True(t, errors.As(err, &se))
+	assert.Equal(t, http.StatusNotFound, se.StatusCode)
+	assert.Equal(t, "s3://releases/missing.json", se.Location)
+
+	fake.lock.Lock()
+	objects["app/latest.json"] = []byte(`{"version": "1.1.0"}`)
+	fake.lock.Unlock()
+	_, err = source.LatestVersion()
+	assert.True(t, errors.Is(err, ErrNoVersion))
+}
+
+func TestAWSSourceMetadata(t *testing.T) {
+	fake, client := s3Server(t, "releases", map[string][]byte{"app": newFile})
+	fake.metadata["app"] = map[string]string{"version": "1.3.0", "build": "42", "critical": "true"}
+
+	version, err := NewAWSSource(client, "releases", "app").LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.3.0", version.Number)
+	assert.Equal(t, 42, version.Build)
+	assert.True(t, version.Critical)
+	assert.NotEmpty(t, version.ETag)
+}
+
+func TestAWSSourceConditional(t *testing.T) {
+	_, client := s3Server(t, "releases", map[string][]byte{"app": newFile})
+	source := NewAWSSource(client, "releases", "app")
+
+	latest, err := source.LatestVersion()
+	assert.Nil(t, err)
+
+	_, _, err = source.Get(&Version{ETag: latest.ETag})
+	assert.True(t, errors.Is(err, ErrNoUpdate))
+
+	_, _, err = source.Get(&Version{Date: s3LastModified.Add(time.Hour)})
+	assert.True(t, errors.Is(err, ErrNoUpdate))
+
+	r, _, err := source.Get(&Version{ETag: `"older"`, Date: s3LastModified.Add(-time.Hour)})
+	assert.Nil(t, err)
+	content, err := io.ReadAll(r)
+	r.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, content)
+}
+
+func TestAWSSourceResume(t *testing.T) {
+	release := bytes.Repeat([]byte("selfupdate"), 100)
+	fake, client := s3Server(t, "releases", map[string][]byte{"app": release})
+	fake.cutAfter = 10
+
+	r, size, err := NewAWSSource(client, "releases", "app").Get(&Version{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(release)), size)
+	content, err := io.ReadAll(r)
+	r.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, release, content)
+	assert.Equal(t, []string{"", "bytes=10-"}, fake.ranges)
+}
+
+func TestAWSSourceChecksum(t *testing.T) {
+	release := bytes.Repeat([]byte("selfupdate"), 100)
+	fake, client := s3Server(t, "releases", map[string][]byte{"app": release})
+	sum := sha256.Sum256(oldFile)
+	fake.checksums["app"] = base64.StdEncoding.EncodeToString(sum[:])
+
+	r, _, err := NewAWSSource(client, "releases", "app").Get(&Version{})
+	assert.Nil(t, err)
+	_, err = io.ReadAll(r)
+	r.Close()
+	assert.True(t, errors.Is(err, ErrChecksumMismatch))
+
+	// also verified when the download is resumed, which S3 does not do for ranged requests
+	fake.cutAfter = 10
+	r, _, err = NewAWSSource(client, "releases", "app").Get(&Version{})
+	assert.Nil(t, err)
+	_, err = io.ReadAll(r)
+	r.Close()
+	assert.True(t, errors.Is(err, ErrChecksumMismatch))
+}
@@ -0,0 +1,118 @@
+// Package azuresource provide a selfupdate.Source that will download the update from an Azure Blob
+// Storage container. It lives in its own package so that applications that do not use Azure do
+// not depend on its SDK.
+//
+//	client, err := azblob.NewClient(serviceURL, credential, nil)
+//	if err != nil {
+//		return err
+//	}
+//	config := &selfupdate.Config{
+//		Source: azuresource.New(client, "mycontainer", "myapp-{{.OS}}-{{.Arch}}{{.Ext}}"),
+//		...
+//	}
+package azuresource
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/solodyagin/selfupdate"
+)
+
+// Source provide a selfupdate.Source that will download the update from an Azure Blob Storage container.
+// It is expecting the signature file to be stored at ${blob}.ed25519
+type Source struct {
+	client    *azblob.Client
+	container string
+	blob      string
+}
+
+var _ selfupdate.Source = (*Source)(nil)
+
+// New provide a selfupdate.Source that will read the blob named after the base in the container,
+// using the azblob.Client provided. The base is a Go Template string that recognize the same
+// parameters as selfupdate.NewHTTPSource. To use an emulator like Azurite, create the client
+// with its service URL.
+func New(client *azblob.Client, container string, base string) selfupdate.Source {
+	return &Source{client: client, container: container, blob: selfupdate.ExpandTemplate(base)}
+}
+
+// Get will return if it succeed an io.ReaderCloser to the new executable being downloaded and its length
+func (s *Source) Get(v *selfupdate.Version) (io.ReadCloser, int64, error) {
+	resp, err := s.client.DownloadStream(context.Background(), s.container, s.blob, nil)
+	if err != nil {
+		return nil, 0, selfupdate.NewSourceError("get", s.location(s.blob), azureError(err))
+	}
+
+	return resp.Body, derefInt64(resp.ContentLength), nil
+}
+
+// GetSignature will return the content of ${blob}.ed25519
+func (s *Source) GetSignature() ([64]byte, error) {
+	resp, err := s.client.DownloadStream(context.Background(), s.container, s.blob+".ed25519", nil)
+	if err != nil {
+		return [64]byte{}, selfupdate.NewSourceError("get signature", s.location(s.blob+".ed25519"), azureError(err))
+	}
+	defer resp.Body.Close()
+
+	signature, err := selfupdate.ReadSignature(resp.Body, derefInt64(resp.ContentLength))
+	if err != nil {
+		return [64]byte{}, selfupdate.NewSourceError("get signature", s.location(s.blob+".ed25519"), err)
+	}
+	return signature, nil
+}
+
+// LatestVersion will return the LastModified time and the size of the executable
+func (s *Source) LatestVersion() (*selfupdate.Version, error) {
+	props, err := s.blobClient(s.blob).GetProperties(context.Background(), nil)
+	if err != nil {
+		return nil, selfupdate.NewSourceError("latest version", s.location(s.blob), azureError(err))
+	}
+
+	v := &selfupdate.Version{Size: derefInt64(props.ContentLength)}
+	if props.LastModified != nil {
+		v.Date = *props.LastModified
+	}
+	return v, nil
+}
+
+func (s *Source) blobClient(name string) *blob.Client {
+	return s.client.ServiceClient().NewContainerClient(s.container).NewBlobClient(name)
+}
+
+func (s *Source) location(name string) string {
+	return s.blobClient(name).URL()
+}
+
+// statusError attach the HTTP status code of an Azure error for selfupdate.NewSourceError
+type statusError struct {
+	error
+	code int
+}
+
+func (e *statusError) HTTPStatusCode() int {
+	return e.code
+}
+
+func (e *statusError) Unwrap() error {
+	return e.error
+}
+
+func azureError(err error) error {
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		return &statusError{error: err, code: respErr.StatusCode}
+	}
+	return err
+}
+
+func derefInt64(v *int64) int64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
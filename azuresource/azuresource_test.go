@@ -0,0 +1,76 @@
+package azuresource
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/solodyagin/selfupdate"
+	"github.com/stretchr/testify/assert"
+)
+
+var newFile = []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+
+// azureServer serves the blobs of a single container the way Azurite does, for download and properties requests
+func azureServer(t *testing.T, container string, blobs map[string][]byte, lastModified time.Time) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := blobs[r.URL.Path[len("/devstoreaccount1/"+container+"/"):]]
+		w.Header().Set("x-ms-version", r.Header.Get("x-ms-version"))
+		if !ok {
+			w.Header().Set("x-ms-error-code", "BlobNotFound")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		w.Header().Set("ETag", `"0x8DA5439F2B2A1B0"`)
+		w.Header().Set("x-ms-blob-type", "BlockBlob")
+		if r.Method == http.MethodGet {
+			w.Write(content)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSource(t *testing.T) {
+	lastModified := time.Date(2022, 6, 22, 10, 0, 0, 0, time.UTC)
+	server := azureServer(t, "releases", map[string][]byte{
+		"app-" + runtime.GOOS:              newFile,
+		"app-" + runtime.GOOS + ".ed25519": make([]byte, 64),
+	}, lastModified)
+
+	client, err := azblob.NewClientWithNoCredential(server.URL+"/devstoreaccount1/", nil)
+	assert.Nil(t, err)
+
+	source := New(client, "releases", "app-{{.OS}}")
+	version, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.True(t, lastModified.Equal(version.Date))
+	assert.Equal(t, int64(len(newFile)), version.Size)
+
+	signature, err := source.GetSignature()
+	assert.Nil(t, err)
+	assert.Equal(t, [64]byte{}, signature)
+
+	r, size, err := source.Get(version)
+	assert.Nil(t, err)
+	content, err := io.ReadAll(r)
+	r.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, content)
+	assert.Equal(t, int64(len(newFile)), size)
+
+	_, _, err = New(client, "releases", "missing").Get(nil)
+	var se *selfupdate.SourceError
+	assert.True(t, errors.As(err, &se))
+	assert.Equal(t, http.StatusNotFound, se.StatusCode)
+	assert.Equal(t, server.URL+"/devstoreaccount1/releases/missing", se.Location)
+}
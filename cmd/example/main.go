@@ -37,7 +37,10 @@ func main() {
 			done <- struct{}{}
 			return true
 		},
-		UpgradeConfirmCallback: func(_ string) bool { return true },
+		UpgradeInfoCallback: func(info *selfupdate.UpgradeInfo) bool {
+			log.Println(info.Reason, "published", info.PublishedAt, "size", info.Size)
+			return true
+		},
 	}
 
 	_, err := selfupdate.Manage(config)
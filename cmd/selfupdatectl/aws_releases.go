@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/solodyagin/selfupdate"
+	"github.com/solodyagin/selfupdate/cmd/selfupdatectl/internal/cloud"
+	"github.com/urfave/cli/v2"
+)
+
+// releasePointerName is the name of the release pointer stored next to the releases
+const releasePointerName = "latest.json"
+
+// releasePath return the immutable key prefix of a release, like `base/v1.2.3/`
+func releasePath(base string, version string) string {
+	return buildTargetPath(base, "v"+strings.TrimPrefix(version, "v")) + "/"
+}
+
+// releaseStore is the part of the S3 session used to manage the releases
+type releaseStore interface {
+	ReadObject(key string) ([]byte, error)
+	WriteObject(key string, content []byte, contentType string) error
+	ListPrefixes(prefix string) ([]string, error)
+	DeletePrefix(prefix string) (int, error)
+}
+
+var _ releaseStore = (*cloud.AWSSession)(nil)
+
+func releasePointerKey(base string) string {
+	return buildTargetPath(base, releasePointerName)
+}
+
+// readReleasePointer return the current release pointer, nil if there is none yet
+func readReleasePointer(session releaseStore, base string) (*selfupdate.ReleasePointer, error) {
+	content, err := session.ReadObject(releasePointerKey(base))
+	if err != nil {
+		if cloud.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	pointer := &selfupdate.ReleasePointer{}
+	if err := json.Unmarshal(content, pointer); err != nil {
+		return nil, fmt.Errorf("invalid release pointer %s: %w", releasePointerKey(base), err)
+	}
+	return pointer, nil
+}
+
+// writeReleasePointer designate the release of the version as the current one, flagging it as a
+// rollback for the clients running a newer version to return to it
+func writeReleasePointer(session releaseStore, base string, version string, rollback bool) error {
+	pointer := selfupdate.ReleasePointer{
+		Version:  strings.TrimPrefix(version, "v"),
+		Path:     releasePath(base, version),
+		Date:     time.Now().UTC(),
+		Rollback: rollback,
+	}
+	content, err := json.MarshalIndent(pointer, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := session.WriteObject(releasePointerKey(base), content, "application/json"); err != nil {
+		return err
+	}
+	fmt.Printf("%s now designate version %s\n", releasePointerKey(base), pointer.Version)
+	return nil
+}
+
+// listReleases return the versions released under the base, newest first
+func listReleases(session releaseStore, base string) ([]string, error) {
+	prefix := ""
+	if base != "" {
+		prefix = strings.TrimSuffix(base, "/") + "/"
+	}
+
+	prefixes, err := session.ListPrefixes(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for _, p := range prefixes {
+		name := strings.TrimSuffix(strings.TrimPrefix(p, prefix), "/")
+		// only the directories named like a version, not any starting with a v
+		if len(name) < 2 || name[0] != 'v' || name[1] < '0' || name[1] > '9' {
+			continue
+		}
+		versions = append(versions, name[1:])
+	}
+
+	slices.SortFunc(versions, func(a, b string) int {
+		switch {
+		case (&selfupdate.Version{Number: a}).Before(&selfupdate.Version{Number: b}):
+			return 1
+		case (&selfupdate.Version{Number: b}).Before(&selfupdate.Version{Number: a}):
+			return -1
+		}
+		return strings.Compare(a, b)
+	})
+	return versions, nil
+}
+
+func awsList() *cli.Command {
+	config := &awsConfig{}
+
+	return &cli.Command{
+		Name:        "aws-list",
+		Usage:       "List the releases uploaded to AWS S3 with a version",
+		Description: "The releases found under the S3 target path specified as argument are listed newest first, the one designated by the release pointer being marked with a star.",
+		Flags:       awsFlags(config),
+		Action: func(ctx *cli.Context) error {
+			if ctx.Args().Len() != 1 {
+				return fmt.Errorf("a S3 target path need to be specified")
+			}
+			config.baseS3Path = ctx.Args().First()
+
+			session, err := config.connect()
+			if err != nil {
+				return err
+			}
+
+			pointer, err := readReleasePointer(session, config.baseS3Path)
+			if err != nil {
+				return err
+			}
+			versions, err := listReleases(session, config.baseS3Path)
+			if err != nil {
+				return err
+			}
+
+			for _, version := range versions {
+				mark := " "
+				if pointer != nil && pointer.Path == releasePath(config.baseS3Path, version) {
+					mark = "*"
+				}
+				fmt.Printf("%s %s\n", mark, version)
+			}
+			return nil
+		},
+	}
+}
+
+func awsRollback() *cli.Command {
+	config := &awsConfig{}
+
+	return &cli.Command{
+		Name:        "aws-rollback",
+		Usage:       "Designate a previous release uploaded to AWS S3 as the current one",
+		Description: "The release pointer under the S3 target path specified as the last argument is updated to designate the version specified as the first argument, which must have been uploaded before. The pointer is flagged as a rollback, so that the clients already running a newer version also return to it.",
+		Flags:       awsFlags(config),
+		Action: func(ctx *cli.Context) error {
+			if ctx.Args().Len() != 2 {
+				return fmt.Errorf("a version and a S3 target path need to be specified")
+			}
+			version := ctx.Args().First()
+			config.baseS3Path = ctx.Args().Get(1)
+
+			session, err := config.connect()
+			if err != nil {
+				return err
+			}
+
+			return rollbackRelease(session, config.baseS3Path, version)
+		},
+	}
+}
+
+func awsPrune() *cli.Command {
+	config := &awsConfig{}
+	keep := 0
+
+	return &cli.Command{
+		Name:        "aws-prune",
+		Usage:       "Delete the oldest releases uploaded to AWS S3",
+		Description: "Only the newest releases found under the S3 target path specified as argument are kept, the release designated by the release pointer is never deleted.",
+		Flags: append([]cli.Flag{
+			&cli.IntFlag{
+				Name:        "keep",
+				Aliases:     []string{"k"},
+				Usage:       "Number of releases to keep",
+				Destination: &keep,
+				Value:       5,
+			},
+		}, awsFlags(config)...),
+		Action: func(ctx *cli.Context) error {
+			if ctx.Args().Len() != 1 {
+				return fmt.Errorf("a S3 target path need to be specified")
+			}
+			config.baseS3Path = ctx.Args().First()
+
+			session, err := config.connect()
+			if err != nil {
+				return err
+			}
+
+			_, err = pruneReleases(session, config.baseS3Path, keep)
+			return err
+		},
+	}
+}
+
+// rollbackRelease designate the release of the version, which must have been uploaded, as the current one
+func rollbackRelease(session releaseStore, base string, version string) error {
+	versions, err := listReleases(session, base)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(versions, strings.TrimPrefix(version, "v")) {
+		return fmt.Errorf("no release %s found in %s", version, releasePath(base, version))
+	}
+
+	return writeReleasePointer(session, base, version, true)
+}
+
+// pruneReleases delete the releases older than the newest ones to keep, except the one designated
+// by the release pointer, and return the versions deleted
+func pruneReleases(session releaseStore, base string, keep int) ([]string, error) {
+	if keep < 1 {
+		return nil, fmt.Errorf("at least one release need to be kept, not %d", keep)
+	}
+
+	pointer, err := readReleasePointer(session, base)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := listReleases(session, base)
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []string
+	for i, version := range versions {
+		path := releasePath(base, version)
+		if i < keep || (pointer != nil && pointer.Path == path) {
+			continue
+		}
+
+		deleted, err := session.DeletePrefix(path)
+		if err != nil {
+			return pruned, err
+		}
+		fmt.Printf("Deleted release %s (%d objects)\n", version, deleted)
+		pruned = append(pruned, version)
+	}
+	return pruned, nil
+}
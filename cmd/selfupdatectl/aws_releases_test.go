@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/solodyagin/selfupdate"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryStore is a bucket kept in memory
+type memoryStore map[string][]byte
+
+var _ releaseStore = memoryStore(nil)
+
+func newMemoryStore(keys ...string) memoryStore {
+	store := memoryStore{}
+	for _, key := range keys {
+		store[key] = []byte(key)
+	}
+	return store
+}
+
+func (m memoryStore) ReadObject(key string) ([]byte, error) {
+	content, ok := m[key]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	return content, nil
+}
+
+func (m memoryStore) WriteObject(key string, content []byte, contentType string) error {
+	m[key] = content
+	return nil
+}
+
+func (m memoryStore) ListPrefixes(prefix string) ([]string, error) {
+	seen := map[string]bool{}
+	var prefixes []string
+	for key := range m {
+		rest, ok := strings.CutPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+		dir, _, isDir := strings.Cut(rest, "/")
+		if isDir && !seen[dir] {
+			seen[dir] = true
+			prefixes = append(prefixes, prefix+dir+"/")
+		}
+	}
+	sort.Strings(prefixes)
+	return prefixes, nil
+}
+
+func (m memoryStore) DeletePrefix(prefix string) (int, error) {
+	deleted := 0
+	for key := range m {
+		if strings.HasPrefix(key, prefix) {
+			delete(m, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (m memoryStore) pointer(t *testing.T, base string) *selfupdate.ReleasePointer {
+	pointer, err := readReleasePointer(m, base)
+	assert.Nil(t, err)
+	return pointer
+}
+
+func TestListReleases(t *testing.T) {
+	for name, test := range map[string]struct {
+		keys     []string
+		base     string
+		expected []string
+	}{
+		"empty": {},
+		"numeric order": {
+			keys:     []string{"app/v1.9.0/app", "app/v1.10.0/app", "app/v1.2.0/app", "app/v1.2.0/app.ed25519", "app/v2.0.0/app"},
+			base:     "app",
+			expected: []string{"2.0.0", "1.10.0", "1.9.0", "1.2.0"},
+		},
+		"trailing slash": {
+			keys:     []string{"app/v1.0.0/app", "app/v1.1.0/app"},
+			base:     "app/",
+			expected: []string{"1.1.0", "1.0.0"},
+		},
+		"bucket root": {
+			keys:     []string{"v1.0.0/app", "v0.9.0/app", "latest.json"},
+			expected: []string{"1.0.0", "0.9.0"},
+		},
+		"not a release": {
+			keys:     []string{"app/v1.0.0/app", "app/vendor/lib", "app/v/app", "app/latest.json", "app/1.1.0/app", "other/v2.0.0/app"},
+			base:     "app",
+			expected: []string{"1.0.0"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			versions, err := listReleases(newMemoryStore(test.keys...), test.base)
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, versions)
+		})
+	}
+}
+
+func TestPruneReleases(t *testing.T) {
+	keys := []string{"app/v1.0.0/app", "app/v1.1.0/app", "app/v1.1.0/app.ed25519", "app/v1.2.0/app", "app/v1.10.0/app", "app/vendor/lib"}
+
+	for name, test := range map[string]struct {
+		keep     int
+		pointer  string
+		expected []string
+		err      bool
+	}{
+		"keep all":         {keep: 4},
+		"keep more":        {keep: 10},
+		"keep newest":      {keep: 2, pointer: "1.10.0", expected: []string{"1.1.0", "1.0.0"}},
+		"keep pointer":     {keep: 1, pointer: "1.1.0", expected: []string{"1.2.0", "1.0.0"}},
+		"without pointer":  {keep: 1, expected: []string{"1.2.0", "1.1.0", "1.0.0"}},
+		"nothing to keep":  {keep: 0, pointer: "1.10.0", err: true},
+		"negative to keep": {keep: -1, err: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			store := newMemoryStore(keys...)
+			if test.pointer != "" {
+				assert.Nil(t, writeReleasePointer(store, "app", test.pointer, false))
+			}
+
+			pruned, err := pruneReleases(store, "app", test.keep)
+			if test.err {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+			assert.Equal(t, test.expected, pruned)
+
+			for _, key := range keys {
+				_, exists := store[key]
+				deleted := false
+				for _, version := range pruned {
+					deleted = deleted || strings.HasPrefix(key, releasePath("app", version))
+				}
+				assert.Equal(t, !deleted, exists, key)
+			}
+			if test.pointer != "" {
+				assert.Equal(t, releasePath("app", test.pointer), store.pointer(t, "app").Path)
+			}
+		})
+	}
+}
+
+func TestRollbackRelease(t *testing.T) {
+	for name, test := range map[string]struct {
+		version  string
+		expected string
+		err      bool
+	}{
+		"previous":       {version: "1.0.0", expected: "1.0.0"},
+		"with v prefix":  {version: "v1.0.0", expected: "1.0.0"},
+		"current":        {version: "1.1.0", expected: "1.1.0"},
+		"missing":        {version: "0.9.0", expected: "1.1.0", err: true},
+		"not a release":  {version: "endor", expected: "1.1.0", err: true},
+		"other location": {version: "2.0.0", expected: "1.1.0", err: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			store := newMemoryStore("app/v1.0.0/app", "app/v1.1.0/app", "app/vendor/lib", "other/v2.0.0/app")
+			assert.Nil(t, writeReleasePointer(store, "app", "1.1.0", false))
+
+			err := rollbackRelease(store, "app", test.version)
+			if test.err {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+
+			pointer := store.pointer(t, "app")
+			assert.Equal(t, test.expected, pointer.Version)
+			assert.Equal(t, releasePath("app", test.expected), pointer.Path)
+			assert.Equal(t, !test.err, pointer.Rollback)
+		})
+	}
+}
+
+func TestReadReleasePointer(t *testing.T) {
+	store := newMemoryStore()
+	assert.Nil(t, store.pointer(t, "app"))
+
+	store["app/latest.json"] = []byte("{")
+	_, err := readReleasePointer(store, "app")
+	assert.NotNil(t, err)
+
+	assert.Nil(t, writeReleasePointer(store, "app", "v1.2.0", false))
+	var pointer selfupdate.ReleasePointer
+	assert.Nil(t, json.Unmarshal(store["app/latest.json"], &pointer))
+	assert.Equal(t, "1.2.0", pointer.Version)
+	assert.Equal(t, "app/v1.2.0/", pointer.Path)
+	assert.False(t, pointer.Rollback)
+	assert.NotContains(t, string(store["app/latest.json"]), "rollback")
+}
+
+func TestReleaseMetadata(t *testing.T) {
+	for name, test := range map[string]struct {
+		version  string
+		build    int
+		critical bool
+		expected map[string]string
+	}{
+		"none":     {expected: map[string]string{}},
+		"version":  {version: "1.2.0", expected: map[string]string{"version": "1.2.0"}},
+		"v prefix": {version: "v1.2.0", expected: map[string]string{"version": "1.2.0"}},
+		"all":      {version: "1.2.0", build: 42, critical: true, expected: map[string]string{"version": "1.2.0", "build": "42", "critical": "true"}},
+		"build":    {build: 7, expected: map[string]string{"build": "7"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.expected, releaseMetadata(test.version, test.build, test.critical))
+		})
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
 
 	"github.com/solodyagin/selfupdate/cmd/selfupdatectl/internal/cloud"
 	"github.com/urfave/cli/v2"
@@ -17,15 +19,63 @@ type awsConfig struct {
 	baseS3Path string
 }
 
+// awsFlags return the flags needed to establish an AWS session, shared by all the aws commands
+func awsFlags(config *awsConfig) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "endpoint",
+			Aliases:     []string{"e"},
+			Usage:       "AWS endpoint to connect to (can be used to connect to non AWS S3 services)",
+			EnvVars:     []string{"AWS_S3_ENDPOINT"},
+			Destination: &config.endpoint,
+		},
+		&cli.StringFlag{
+			Name:        "region",
+			Aliases:     []string{"r"},
+			Usage:       "AWS region to connect to",
+			EnvVars:     []string{"AWS_S3_REGION"},
+			Destination: &config.region,
+		},
+		&cli.StringFlag{
+			Name:        "bucket",
+			Aliases:     []string{"b"},
+			Usage:       "AWS bucket to store data into",
+			EnvVars:     []string{"AWS_S3_BUCKET"},
+			Destination: &config.bucket,
+		},
+		&cli.StringFlag{
+			Name:        "secret",
+			Aliases:     []string{"s"},
+			Usage:       "AWS secret to use to establish S3 connection",
+			Destination: &config.secret,
+		},
+		&cli.StringFlag{
+			Name:        "accesskey",
+			Aliases:     []string{"a"},
+			Usage:       "AWS Access Key ID to use to establish S3 connection",
+			Destination: &config.accessKey,
+		},
+	}
+}
+
+func (config *awsConfig) connect() (*cloud.AWSSession, error) {
+	log.Println("Connecting to AWS")
+	return cloud.NewAWSSession(config.accessKey, config.secret, config.endpoint, config.region, config.bucket)
+}
+
 func awsUpload() *cli.Command {
 	a := &application{}
 	config := &awsConfig{}
+	version := ""
+	build := 0
+	critical := false
 
 	return &cli.Command{
-		Name:        "aws-upload",
-		Usage:       "Upload an executable file to AWS S3, it will be signed and the signature uploaded too",
-		Description: "The executable specified will get its signature generated and checked before being uploaded to a AWS S3 bucket location specified as the last arguments.",
-		Flags: []cli.Flag{
+		Name:  "aws-upload",
+		Usage: "Upload executable files to AWS S3, they will be signed and the signatures uploaded too",
+		Description: "The executables specified will get their signature generated and checked before being uploaded to a AWS S3 bucket location specified as the last arguments. " +
+			"When a version is specified, they are uploaded under their own release path, like `target/v1.2.3/`, and the `target/" + releasePointerName + "` pointer is then updated to designate that release.",
+		Flags: append([]cli.Flag{
 			&cli.StringFlag{
 				Name:        "private-key",
 				Aliases:     []string{"priv"},
@@ -41,80 +91,69 @@ func awsUpload() *cli.Command {
 				Value:       "ed25519.pem",
 			},
 			&cli.StringFlag{
-				Name:        "endpoint",
-				Aliases:     []string{"e"},
-				Usage:       "AWS endpoint to connect to (can be used to connect to non AWS S3 services)",
-				EnvVars:     []string{"AWS_S3_ENDPOINT"},
-				Destination: &config.endpoint,
-			},
-			&cli.StringFlag{
-				Name:        "region",
-				Aliases:     []string{"r"},
-				Usage:       "AWS region to connect to",
-				EnvVars:     []string{"AWS_S3_REGION"},
-				Destination: &config.region,
-			},
-			&cli.StringFlag{
-				Name:        "bucket",
-				Aliases:     []string{"b"},
-				Usage:       "AWS bucket to store data into",
-				EnvVars:     []string{"AWS_S3_BUCKET"},
-				Destination: &config.bucket,
+				Name:        "version",
+				Aliases:     []string{"v"},
+				Usage:       "Version of the release, to upload it to immutable keys and update the release pointer",
+				Destination: &version,
 			},
-			&cli.StringFlag{
-				Name:        "secret",
-				Aliases:     []string{"s"},
-				Usage:       "AWS secret to use to establish S3 connection",
-				Destination: &config.secret,
+			&cli.IntFlag{
+				Name:        "build",
+				Usage:       "Build number of the release, stored in the metadata of the executables",
+				Destination: &build,
 			},
-			&cli.StringFlag{
-				Name:        "accesskey",
-				Aliases:     []string{"a"},
-				Usage:       "AWS Access Key ID to use to establish S3 connection",
-				Destination: &config.accessKey,
+			&cli.BoolFlag{
+				Name:        "critical",
+				Usage:       "Flag the release as a critical update in the metadata of the executables",
+				Destination: &critical,
 			},
-		},
+		}, awsFlags(config)...),
 		Action: func(ctx *cli.Context) error {
-			if ctx.Args().Len() != 2 {
-				return fmt.Errorf("one executable and a S3 target path need to be specified")
+			if ctx.Args().Len() < 2 {
+				return fmt.Errorf("at least one executable and a S3 target path need to be specified")
 			}
 
-			log.Println("Connecting to AWS")
-			session, err := cloud.NewAWSSession(config.accessKey, config.secret, config.endpoint, config.region, config.bucket)
+			session, err := config.connect()
 			if err != nil {
 				return err
 			}
 
-			config.baseS3Path = ctx.Args().Slice()[ctx.Args().Len()-1]
+			session.SetMetadata(releaseMetadata(version, build, critical))
 
-			exe := ctx.Args().First()
-			s3path := buildS3Path(config.baseS3Path, exe)
+			args := ctx.Args().Slice()
+			config.baseS3Path = args[len(args)-1]
+			executables := args[:len(args)-1]
 
-			err = a.awsUpload(session, exe, s3path)
-			if err != nil {
-				return err
+			target := config.baseS3Path
+			if version != "" {
+				target = releasePath(config.baseS3Path, version)
 			}
-			return nil
+
+			for _, exe := range executables {
+				if err := a.upload(session, exe, buildTargetPath(target, exe)); err != nil {
+					return err
+				}
+			}
+
+			if version == "" {
+				return nil
+			}
+			// only designate the release once all of its executables are available
+			return writeReleasePointer(session, config.baseS3Path, version, false)
 		},
 	}
 }
 
-func (a *application) awsUpload(session *cloud.AWSSession, executable string, destination string) error {
-	if a.check(executable) != nil {
-		if err := a.sign(executable); err != nil {
-			return err
-		}
-		if err := a.check(executable); err != nil {
-			return err
-		}
+// releaseMetadata return the user metadata read by selfupdate.AWSSource to fill the version
+func releaseMetadata(version string, build int, critical bool) map[string]string {
+	metadata := map[string]string{}
+	if version != "" {
+		metadata["version"] = strings.TrimPrefix(version, "v")
 	}
-
-	err := session.UploadFile(executable, destination)
-	if err != nil {
-		return err
+	if build != 0 {
+		metadata["build"] = strconv.Itoa(build)
 	}
-	fmt.Println()
-
-	defer fmt.Println()
-	return session.UploadFile(executable+".ed25519", destination+".ed25519")
+	if critical {
+		metadata["critical"] = "true"
+	}
+	return metadata
 }
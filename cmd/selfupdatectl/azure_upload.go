@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/solodyagin/selfupdate/cmd/selfupdatectl/internal/cloud"
+	"github.com/urfave/cli/v2"
+)
+
+type azureConfig struct {
+	connectionString string
+	endpoint         string
+	account          string
+	key              string
+	container        string
+	basePath         string
+}
+
+func azureUpload() *cli.Command {
+	a := &application{}
+	config := &azureConfig{}
+
+	return &cli.Command{
+		Name:        "azure-upload",
+		Usage:       "Upload an executable file to Azure Blob Storage, it will be signed and the signature uploaded too",
+		Description: "The executable specified will get its signature generated and checked before being uploaded to an Azure Blob Storage container location specified as the last arguments.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "private-key",
+				Aliases:     []string{"priv"},
+				Usage:       "The private key file to store the new key in.",
+				Destination: &a.privateKey,
+				Value:       "ed25519.key",
+			},
+			&cli.StringFlag{
+				Name:        "public-key",
+				Aliases:     []string{"pub"},
+				Usage:       "The public key file to store the new key in.",
+				Destination: &a.publicKey,
+				Value:       "ed25519.pem",
+			},
+			&cli.StringFlag{
+				Name:        "connection-string",
+				Usage:       "Azure Storage connection string, used instead of the account, key and endpoint",
+				EnvVars:     []string{"AZURE_STORAGE_CONNECTION_STRING"},
+				Destination: &config.connectionString,
+			},
+			&cli.StringFlag{
+				Name:        "endpoint",
+				Aliases:     []string{"e"},
+				Usage:       "Azure Blob service URL to connect to (can be used to connect to Azurite)",
+				EnvVars:     []string{"AZURE_STORAGE_ENDPOINT"},
+				Destination: &config.endpoint,
+			},
+			&cli.StringFlag{
+				Name:        "account",
+				Aliases:     []string{"a"},
+				Usage:       "Azure Storage account name",
+				EnvVars:     []string{"AZURE_STORAGE_ACCOUNT"},
+				Destination: &config.account,
+			},
+			&cli.StringFlag{
+				Name:        "key",
+				Aliases:     []string{"k"},
+				Usage:       "Azure Storage account key",
+				EnvVars:     []string{"AZURE_STORAGE_KEY"},
+				Destination: &config.key,
+			},
+			&cli.StringFlag{
+				Name:        "container",
+				Aliases:     []string{"c"},
+				Usage:       "Azure Blob container to store data into",
+				EnvVars:     []string{"AZURE_STORAGE_CONTAINER"},
+				Destination: &config.container,
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			if ctx.Args().Len() != 2 {
+				return fmt.Errorf("one executable and an Azure Blob target path need to be specified")
+			}
+
+			log.Println("Connecting to Azure Blob Storage")
+			session, err := cloud.NewAzureSession(config.connectionString, config.account, config.key, config.endpoint, config.container)
+			if err != nil {
+				return err
+			}
+
+			config.basePath = ctx.Args().Slice()[ctx.Args().Len()-1]
+
+			exe := ctx.Args().First()
+			return a.upload(session, exe, buildTargetPath(config.basePath, exe))
+		},
+	}
+}
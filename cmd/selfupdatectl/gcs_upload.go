@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/solodyagin/selfupdate/cmd/selfupdatectl/internal/cloud"
+	"github.com/urfave/cli/v2"
+)
+
+type gcsConfig struct {
+	endpoint string
+	bucket   string
+	basePath string
+}
+
+func gcsUpload() *cli.Command {
+	a := &application{}
+	config := &gcsConfig{}
+
+	return &cli.Command{
+		Name:        "gcs-upload",
+		Usage:       "Upload an executable file to Google Cloud Storage, it will be signed and the signature uploaded too",
+		Description: "The executable specified will get its signature generated and checked before being uploaded to a Google Cloud Storage bucket location specified as the last arguments.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "private-key",
+				Aliases:     []string{"priv"},
+				Usage:       "The private key file to store the new key in.",
+				Destination: &a.privateKey,
+				Value:       "ed25519.key",
+			},
+			&cli.StringFlag{
+				Name:        "public-key",
+				Aliases:     []string{"pub"},
+				Usage:       "The public key file to store the new key in.",
+				Destination: &a.publicKey,
+				Value:       "ed25519.pem",
+			},
+			&cli.StringFlag{
+				Name:        "endpoint",
+				Aliases:     []string{"e"},
+				Usage:       "GCS endpoint to connect to without authentication (can be used to connect to fake-gcs-server)",
+				EnvVars:     []string{"GCS_ENDPOINT"},
+				Destination: &config.endpoint,
+			},
+			&cli.StringFlag{
+				Name:        "bucket",
+				Aliases:     []string{"b"},
+				Usage:       "GCS bucket to store data into",
+				EnvVars:     []string{"GCS_BUCKET"},
+				Destination: &config.bucket,
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			if ctx.Args().Len() != 2 {
+				return fmt.Errorf("one executable and a GCS target path need to be specified")
+			}
+
+			log.Println("Connecting to Google Cloud Storage")
+			session, err := cloud.NewGCSSession(config.endpoint, config.bucket)
+			if err != nil {
+				return err
+			}
+
+			config.basePath = ctx.Args().Slice()[ctx.Args().Len()-1]
+
+			exe := ctx.Args().First()
+			return a.upload(session, exe, buildTargetPath(config.basePath, exe))
+		},
+	}
+}
@@ -1,14 +1,42 @@
 package main
 
-func buildS3Path(baseS3Path string, exe string) string {
-	s3path := ""
-	if baseS3Path != "" {
-		s3path = baseS3Path
-		if baseS3Path[len(baseS3Path)-1] != '/' {
-			s3path += "/"
+import "fmt"
+
+func buildTargetPath(basePath string, exe string) string {
+	target := ""
+	if basePath != "" {
+		target = basePath
+		if basePath[len(basePath)-1] != '/' {
+			target += "/"
 		}
 	}
-	s3path += exe
+	target += exe
+
+	return target
+}
+
+// uploader is implemented by the cloud sessions
+type uploader interface {
+	UploadFile(localFile string, remotePath string) error
+}
+
+// upload sign and check the executable if needed, then upload it along with its signature
+func (a *application) upload(session uploader, executable string, destination string) error {
+	if a.check(executable) != nil {
+		if err := a.sign(executable); err != nil {
+			return err
+		}
+		if err := a.check(executable); err != nil {
+			return err
+		}
+	}
+
+	err := session.UploadFile(executable, destination)
+	if err != nil {
+		return err
+	}
+	fmt.Println()
 
-	return s3path
+	defer fmt.Println()
+	return session.UploadFile(executable+".ed25519", destination+".ed25519")
 }
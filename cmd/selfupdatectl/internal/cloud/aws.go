@@ -1,7 +1,9 @@
 package cloud
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -12,12 +14,14 @@ import (
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 // AWSSession represent a live session to AWS services
 type AWSSession struct {
-	client *s3.Client
-	bucket string
+	client   *s3.Client
+	bucket   string
+	metadata map[string]string
 }
 
 // NewAWSSession create a new session
@@ -38,7 +42,12 @@ func NewAWSSession(accessKey string, secret string, endpoint string, region stri
 	return &AWSSession{client: client, bucket: bucket}, nil
 }
 
-// UploadFile to a S3 bucket
+// SetMetadata define the user metadata stored along with the files uploaded afterward
+func (s *AWSSession) SetMetadata(metadata map[string]string) {
+	s.metadata = metadata
+}
+
+// UploadFile to a S3 bucket, S3 storing the SHA-256 checksum of the file
 func (s *AWSSession) UploadFile(localFile string, s3FilePath string) error {
 	file, err := os.Open(localFile)
 	if err != nil {
@@ -53,17 +62,101 @@ func (s *AWSSession) UploadFile(localFile string, s3FilePath string) error {
 
 	pa := &progressAWS{File: file, file: s3FilePath, contentLength: st.Size()}
 
-	uploader := manager.NewUploader(s.client)
+	uploader := manager.NewUploader(s.client, func(u *manager.Uploader) {
+		// a single part upload, for the checksum to be the one of the whole file instead of
+		// a checksum of the checksums of the parts
+		u.PartSize = max(st.Size()+1, manager.DefaultUploadPartSize)
+	})
 
 	_, err = uploader.Upload(context.Background(), &s3.PutObjectInput{
+		Bucket:            aws.String(s.bucket),
+		Key:               aws.String(s3FilePath),
+		Body:              pa,
+		ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
+		Metadata:          s.metadata,
+	})
+
+	return err
+}
+
+// ReadObject return the content of an object of the bucket
+func (s *AWSSession) ReadObject(key string) ([]byte, error) {
+	obj, err := s.client.GetObject(context.Background(), &s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
-		Key:    aws.String(s3FilePath),
-		Body:   pa,
+		Key:    aws.String(key),
 	})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Body.Close()
+
+	return io.ReadAll(obj.Body)
+}
 
+// IsNotFound reports whether the error is caused by a missing object
+func IsNotFound(err error) bool {
+	var noSuchKey *types.NoSuchKey
+	var notFound *types.NotFound
+	return errors.As(err, &noSuchKey) || errors.As(err, &notFound)
+}
+
+// WriteObject store a small object in the bucket
+func (s *AWSSession) WriteObject(key string, content []byte, contentType string) error {
+	_, err := s.client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(content),
+		ContentType: aws.String(contentType),
+	})
 	return err
 }
 
+// ListPrefixes return the sub directories of a prefix, like `releases/v1.2.3/` for `releases/`
+func (s *AWSSession) ListPrefixes(prefix string) ([]string, error) {
+	var prefixes []string
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range page.CommonPrefixes {
+			prefixes = append(prefixes, aws.ToString(p.Prefix))
+		}
+	}
+	return prefixes, nil
+}
+
+// DeletePrefix delete all the objects under a prefix and return how many were deleted
+func (s *AWSSession) DeletePrefix(prefix string) (int, error) {
+	deleted := 0
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return deleted, err
+		}
+		for _, obj := range page.Contents {
+			_, err := s.client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+				Bucket: aws.String(s.bucket),
+				Key:    obj.Key,
+			})
+			if err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
 type progressAWS struct {
 	*os.File
 	file          string
@@ -0,0 +1,63 @@
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+)
+
+// AzureSession represent a live session to Azure Blob Storage
+type AzureSession struct {
+	client    *azblob.Client
+	container string
+}
+
+// NewAzureSession create a new session from a connection string if specified, otherwise from the
+// account name and key. The endpoint default to https://${account}.blob.core.windows.net/ and can
+// point to an emulator like Azurite.
+func NewAzureSession(connectionString string, account string, key string, endpoint string, container string) (*AzureSession, error) {
+	if connectionString != "" {
+		client, err := azblob.NewClientFromConnectionString(connectionString, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &AzureSession{client: client, container: container}, nil
+	}
+
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net/", account)
+	}
+
+	cred, err := azblob.NewSharedKeyCredential(account, key)
+	if err != nil {
+		return nil, err
+	}
+	client, err := azblob.NewClientWithSharedKeyCredential(endpoint, cred, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AzureSession{client: client, container: container}, nil
+}
+
+// UploadFile to an Azure Blob Storage container
+func (s *AzureSession) UploadFile(localFile string, blobPath string) error {
+	file, err := os.Open(localFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	st, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	p := &progressReader{file: blobPath, contentLength: st.Size()}
+	_, err = s.client.UploadFile(context.Background(), s.container, blobPath, file, &azblob.UploadFileOptions{
+		Progress: p.report,
+	})
+	return err
+}
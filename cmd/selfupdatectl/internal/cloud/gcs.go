@@ -0,0 +1,53 @@
+package cloud
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+)
+
+// GCSSession represent a live session to Google Cloud Storage
+type GCSSession struct {
+	client *storage.Client
+	bucket string
+}
+
+// NewGCSSession create a new session using the application default credentials, unless an
+// endpoint is specified, like the one of fake-gcs-server, in which case no authentication is done
+func NewGCSSession(endpoint string, bucket string) (*GCSSession, error) {
+	var opts []option.ClientOption
+	if endpoint != "" {
+		opts = append(opts, option.WithEndpoint(endpoint), option.WithoutAuthentication())
+	}
+
+	client, err := storage.NewClient(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GCSSession{client: client, bucket: bucket}, nil
+}
+
+// UploadFile to a GCS bucket
+func (s *GCSSession) UploadFile(localFile string, objectPath string) error {
+	file, err := os.Open(localFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	st, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	w := s.client.Bucket(s.bucket).Object(objectPath).NewWriter(context.Background())
+	if _, err := io.Copy(w, &progressReader{Reader: file, file: objectPath, contentLength: st.Size()}); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,36 @@
+package cloud
+
+import (
+	"fmt"
+	"io"
+)
+
+// progressReader print the upload progress of a file being streamed
+type progressReader struct {
+	io.Reader
+	file          string
+	contentLength int64
+	uploaded      int64
+	ticker        int
+}
+
+var _ io.Reader = (*progressReader)(nil)
+
+// Read file content
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.Reader.Read(p)
+	if n > 0 {
+		pr.report(pr.uploaded + int64(n))
+	}
+	return n, err
+}
+
+func (pr *progressReader) report(uploaded int64) {
+	pr.uploaded = uploaded
+	if pr.contentLength == 0 {
+		return
+	}
+
+	pr.ticker = (pr.ticker + 1) % len(ticker)
+	fmt.Printf("\r%v: %v%% %c", pr.file, 100*pr.uploaded/pr.contentLength, rune(ticker[pr.ticker]))
+}
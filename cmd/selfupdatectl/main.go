@@ -18,6 +18,11 @@ func main() {
 			check(),
 			keyPrint(),
 			awsUpload(),
+			awsList(),
+			awsRollback(),
+			awsPrune(),
+			gcsUpload(),
+			azureUpload(),
 		},
 	}
 
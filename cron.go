@@ -0,0 +1,195 @@
+package selfupdate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed cron expression, each field being the set of values it matches
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	location                      *time.Location
+}
+
+// cronField describe the range of values accepted by a field of a cron expression
+type cronField struct {
+	name     string
+	min, max int
+	names    []string // names of the values starting at min, if any
+}
+
+var (
+	cronMinute = cronField{name: "minute", min: 0, max: 59}
+	cronHour   = cronField{name: "hour", min: 0, max: 23}
+	cronDom    = cronField{name: "day of month", min: 1, max: 31}
+	cronMonth  = cronField{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	cronDow    = cronField{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseCron parse a standard cron expression "minute hour day-of-month month day-of-week",
+// optionally prefixed by CRON_TZ=Location. Fields accept *, lists, ranges, steps and the
+// english abbreviation of months and days, 0 or 7 being sunday, as well as the @daily like macros.
+// When both the day of month and the day of week are restricted, either of them has to match.
+func parseCron(expr string) (*cronSchedule, error) {
+	c := &cronSchedule{location: time.Local}
+
+	spec := strings.TrimSpace(expr)
+	if strings.HasPrefix(spec, "CRON_TZ=") {
+		tz, rest, _ := strings.Cut(spec, " ")
+		location, err := time.LoadLocation(strings.TrimPrefix(tz, "CRON_TZ="))
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+		}
+		c.location, spec = location, strings.TrimSpace(rest)
+	}
+	if macro, ok := cronMacros[spec]; ok {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields, got %d", expr, len(fields))
+	}
+
+	var err error
+	for i, f := range []struct {
+		set   *uint64
+		field cronField
+	}{{&c.minute, cronMinute}, {&c.hour, cronHour}, {&c.dom, cronDom}, {&c.month, cronMonth}, {&c.dow, cronDow}} {
+		if *f.set, err = f.field.parse(fields[i]); err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+		}
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+
+	if c.next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("invalid cron expression %q: never matches", expr)
+	}
+	return c, nil
+}
+
+// parse return the set of values matched by a comma separated list of ranges
+func (f cronField) parse(field string) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		expr, step, hasStep := strings.Cut(part, "/")
+		n := 1
+		if hasStep {
+			var err error
+			if n, err = strconv.Atoi(step); err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid %s step %q", f.name, step)
+			}
+		}
+
+		low, high := f.min, f.max
+		if expr != "*" {
+			from, to, isRange := strings.Cut(expr, "-")
+			var err error
+			if low, err = f.value(from); err != nil {
+				return 0, err
+			}
+			high = low
+			if isRange {
+				if high, err = f.value(to); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				high = f.max
+			}
+			if high < low {
+				return 0, fmt.Errorf("invalid %s range %q", f.name, expr)
+			}
+		}
+
+		for v := low; v <= high; v += n {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// value return the number of a single value, given as a number or a name
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s %q", f.name, s)
+	}
+	return v, nil
+}
+
+// matchDay reports whether the day of t is matched by the day of month and day of week fields
+func (c *cronSchedule) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<t.Weekday()) != 0
+
+	domAll := c.dom == cronDom.all()
+	dowAll := c.dow|1<<7 == cronDow.all()
+	switch {
+	case domAll && dowAll:
+		return true
+	case domAll:
+		return dow
+	case dowAll:
+		return dom
+	}
+	return dom || dow
+}
+
+func (f cronField) all() uint64 {
+	var set uint64
+	for v := f.min; v <= f.max; v++ {
+		set |= 1 << v
+	}
+	return set
+}
+
+// next return the first time strictly after t matching the expression, the zero time if it never does
+func (c *cronSchedule) next(t time.Time) time.Time {
+	t = t.In(c.location)
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, c.location).Add(time.Minute)
+
+	// the leap day of a 29th of February can be 8 years away
+	limit := t.AddDate(9, 0, 0)
+	for t.Before(limit) {
+		var next time.Time
+		switch {
+		case c.month&(1<<t.Month()) == 0:
+			next = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, c.location)
+		case !c.matchDay(t):
+			next = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.location)
+		case c.hour&(1<<t.Hour()) == 0:
+			next = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, c.location)
+		case c.minute&(1<<t.Minute()) == 0:
+			next = t.Add(time.Minute)
+		default:
+			return t
+		}
+
+		// a daylight saving time change may bring the wall clock back
+		if !next.After(t) {
+			next = t.Add(time.Minute)
+		}
+		t = next
+	}
+	return time.Time{}
+}
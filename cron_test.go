@@ -0,0 +1,68 @@
+package selfupdate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCronNext(t *testing.T) {
+	// a wednesday
+	now := time.Date(2024, 5, 15, 10, 30, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		expr string
+		next time.Time
+	}{
+		{"CRON_TZ=UTC */15 * * * *", time.Date(2024, 5, 15, 10, 45, 0, 0, time.UTC)},
+		{"CRON_TZ=UTC 30 10 * * *", time.Date(2024, 5, 16, 10, 30, 0, 0, time.UTC)},
+		{"CRON_TZ=UTC 0 3 * * mon-fri", time.Date(2024, 5, 16, 3, 0, 0, 0, time.UTC)},
+		{"CRON_TZ=UTC 0 3 * * 0", time.Date(2024, 5, 19, 3, 0, 0, 0, time.UTC)},
+		{"CRON_TZ=UTC 0 3 * * 7", time.Date(2024, 5, 19, 3, 0, 0, 0, time.UTC)},
+		{"CRON_TZ=UTC 0 0 1,15 * *", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"CRON_TZ=UTC 0 0 1 * fri", time.Date(2024, 5, 17, 0, 0, 0, 0, time.UTC)},
+		{"CRON_TZ=UTC 0 12 29 feb *", time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC)},
+		{"CRON_TZ=UTC @monthly", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"CRON_TZ=UTC 5-10/5 11 * * *", time.Date(2024, 5, 15, 11, 5, 0, 0, time.UTC)},
+	} {
+		c, err := parseCron(tc.expr)
+		if !assert.Nil(t, err, tc.expr) {
+			continue
+		}
+		assert.Equal(t, tc.next, c.next(now), tc.expr)
+	}
+}
+
+func TestCronDaylightSaving(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+
+	// 02:30 does not exist on the 31st of March 2024 in Paris
+	c, err := parseCron("CRON_TZ=Europe/Paris 30 2 * * *")
+	assert.Nil(t, err)
+	next := c.next(time.Date(2024, 3, 30, 12, 0, 0, 0, paris))
+	assert.Equal(t, time.Date(2024, 4, 1, 2, 30, 0, 0, paris), next)
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"10-5 * * * *",
+		"* * * foo *",
+		"0 0 30 feb *",
+		"CRON_TZ=Nowhere/Else * * * * *",
+	} {
+		_, err := parseCron(expr)
+		assert.NotNil(t, err, expr)
+	}
+}
@@ -0,0 +1,90 @@
+package selfupdate
+
+import (
+	"slices"
+	"time"
+)
+
+// UpgradeAction is what the user decided to do with an update
+type UpgradeAction int
+
+const (
+	// ActionInstallNow download and install the update right away
+	ActionInstallNow UpgradeAction = iota
+	// ActionRemindLater propose the update again once UpgradeDecision.Later has elapsed
+	ActionRemindLater
+	// ActionSkipVersion never propose this version again, until Updater.ClearSkippedVersions is called
+	ActionSkipVersion
+	// ActionInstallOnExit download the update in the background and stage it, to be installed
+	// when the application exits
+	ActionInstallOnExit
+)
+
+// String return the name of the action
+func (a UpgradeAction) String() string {
+	switch a {
+	case ActionInstallNow:
+		return "install_now"
+	case ActionRemindLater:
+		return "remind_later"
+	case ActionSkipVersion:
+		return "skip_version"
+	case ActionInstallOnExit:
+		return "install_on_exit"
+	}
+	return "unknown"
+}
+
+// UpgradeDecision is the answer of the user to an update proposed by Config.UpgradeDecisionCallback
+type UpgradeDecision struct {
+	Action UpgradeAction // What to do with the update
+	Later  time.Duration // Delay before proposing the update again with ActionRemindLater, Config.DeclineDelay if not set
+}
+
+// decisionOf convert the answer of UpgradeConfirmCallback and UpgradeInfoCallback to a decision,
+// a decline being a reminder after Config.DeclineDelay
+func decisionOf(accepted bool) UpgradeDecision {
+	if accepted {
+		return UpgradeDecision{Action: ActionInstallNow}
+	}
+	return UpgradeDecision{Action: ActionRemindLater}
+}
+
+// recordDecision remember the decision of the user for the next checks
+func (u *Updater) recordDecision(v *Version, decision UpgradeDecision) {
+	key := versionKey(v)
+	now := time.Now()
+
+	switch decision.Action {
+	case ActionRemindLater:
+		u.saveState(func(state *persistedState) {
+			state.Declined = &declinedUpdate{Version: key, At: now}
+			if decision.Later > 0 {
+				state.Declined.Until = now.Add(decision.Later)
+			}
+		})
+	case ActionSkipVersion:
+		u.saveState(func(state *persistedState) {
+			if !slices.Contains(state.Skipped, key) {
+				state.Skipped = append(state.Skipped, key)
+			}
+		})
+	case ActionInstallOnExit:
+		u.saveState(func(state *persistedState) {
+			state.OnExit = key
+		})
+	}
+}
+
+// installOnExit reports whether the staged version is to be installed when the application exits
+func (u *Updater) installOnExit(pending *Version) bool {
+	return pending != nil && u.store().get().OnExit == versionKey(pending)
+}
+
+// ClearSkippedVersions forget the versions the user decided to skip and the ones that failed to
+// be verified too many times, so that they are proposed again
+func (u *Updater) ClearSkippedVersions() error {
+	return u.store().update(func(state *persistedState) {
+		state.Skipped, state.Failed = nil, nil
+	})
+}
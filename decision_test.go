@@ -0,0 +1,107 @@
+package selfupdate
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newDecisionUpdater return an updater to version 1.2.0 that count how many times the user
+// is asked and always answer the decision given
+func newDecisionUpdater(t *testing.T, decision *UpgradeDecision, asked *int) (*Updater, *testSource) {
+	source, publicKey := newSignedTestSource(t, "1.2.0")
+	updater := newTestUpdater(t, &Config{
+		Current:   &Version{Number: "1.0.0"},
+		Source:    source,
+		PublicKey: publicKey,
+		UpgradeDecisionCallback: func(*UpgradeInfo) UpgradeDecision {
+			*asked++
+			return *decision
+		},
+	})
+	return updater, source
+}
+
+func TestDecisionRemindLater(t *testing.T) {
+	decision := UpgradeDecision{Action: ActionRemindLater, Later: time.Hour}
+	asked := 0
+	updater, _ := newDecisionUpdater(t, &decision, &asked)
+
+	assert.Nil(t, updater.CheckNow())
+	assert.Nil(t, updater.CheckNow())
+	assert.Equal(t, 1, asked)
+	assert.Equal(t, EventNoUpdate, updater.Status().LastResult)
+
+	// the reminder is due
+	updater.saveState(func(state *persistedState) {
+		state.Declined.Until = time.Now().Add(-time.Minute)
+	})
+	decision = UpgradeDecision{Action: ActionInstallNow}
+	assert.Nil(t, updater.CheckNow())
+	assert.Equal(t, 2, asked)
+	assert.Equal(t, EventInstalled, updater.Status().LastResult)
+}
+
+func TestDecisionSkipVersion(t *testing.T) {
+	decision := UpgradeDecision{Action: ActionSkipVersion}
+	asked := 0
+	updater, source := newDecisionUpdater(t, &decision, &asked)
+	updater.conf.DeclineDelay = -1
+
+	assert.Nil(t, updater.CheckNow())
+	assert.Nil(t, updater.CheckNow())
+	assert.Equal(t, 1, asked)
+
+	// remembered after a restart
+	restarted := newTestUpdater(t, &Config{
+		Current:                 updater.conf.Current,
+		Source:                  source,
+		PublicKey:               updater.conf.PublicKey,
+		StatePath:               updater.conf.StatePath,
+		UpgradeDecisionCallback: updater.conf.UpgradeDecisionCallback,
+	})
+	assert.Nil(t, restarted.CheckNow())
+	assert.Equal(t, 1, asked)
+
+	// a newer version is proposed
+	source.version = &Version{Number: "1.2.1"}
+	assert.Nil(t, restarted.CheckNow())
+	assert.Equal(t, 2, asked)
+
+	source.version = &Version{Number: "1.2.0"}
+	assert.Nil(t, restarted.ClearSkippedVersions())
+	assert.Nil(t, restarted.CheckNow())
+	assert.Equal(t, 3, asked)
+
+	// unless it is mandatory
+	source.version = &Version{Number: "1.2.0", Critical: true}
+	restarted.conf.MandatoryPolicy = MandatoryForceConfirm
+	assert.Nil(t, restarted.CheckNow())
+	assert.Equal(t, 4, asked)
+	assert.Equal(t, EventInstalled, restarted.Status().LastResult)
+}
+
+func TestDecisionInstallOnExit(t *testing.T) {
+	decision := UpgradeDecision{Action: ActionInstallOnExit}
+	asked := 0
+	updater, _ := newDecisionUpdater(t, &decision, &asked)
+
+	assert.Nil(t, updater.CheckNow())
+	assert.Equal(t, EventStaged, updater.Status().LastResult)
+	assert.Equal(t, "1.2.0", updater.Pending().Number)
+	content, err := os.ReadFile(updater.target)
+	assert.Nil(t, err)
+	assert.Equal(t, oldFile, content)
+
+	// the scheduler leave it staged
+	s, err := newScheduler(updater)
+	assert.Nil(t, err)
+	assert.Nil(t, s.trigger())
+	assert.Equal(t, 1, asked)
+	assert.Equal(t, "1.2.0", updater.Pending().Number)
+	content, err = os.ReadFile(updater.target)
+	assert.Nil(t, err)
+	assert.Equal(t, oldFile, content)
+}
@@ -0,0 +1,231 @@
+package selfupdate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DirSource provide a Source that will read the update from a local directory, like a USB
+// stick or a mounted share, for installations that never reach the network.
+// It is expecting the signature file to be next to the executable at ${path}.ed25519
+type DirSource struct {
+	path     string
+	manifest string
+
+	lock   sync.Mutex
+	binary string
+}
+
+var _ Source = (*DirSource)(nil)
+
+// DirSourceOption configure a DirSource
+type DirSourceOption func(*DirSource)
+
+// WithDirManifest read the release information from a JSON manifest, in the same format as the
+// one of NewManifestSource, when it is present at the specified path. Its url, if any, is
+// relative to the manifest and replace the executable path given to NewDirSource.
+func WithDirManifest(path string) DirSourceOption {
+	return func(d *DirSource) {
+		d.manifest = localPath(path)
+	}
+}
+
+// NewDirSource provide a selfupdate.Source that will read the executable at the specified path,
+// which can also be a file:// URL. The path is a Go Template string that recognize the same
+// parameters as NewHTTPSource. Unless a manifest is present, the version of the update is the
+// modification time of the executable.
+func NewDirSource(path string, opts ...DirSourceOption) *DirSource {
+	d := &DirSource{path: localPath(path)}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Get will return if it succeed an io.ReaderCloser to the new executable and its size
+func (d *DirSource) Get(v *Version) (io.ReadCloser, int64, error) {
+	binary, err := d.binaryPath()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	f, err := os.Open(binary)
+	if err != nil {
+		return nil, 0, newSourceError("get", binary, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, newSourceError("get", binary, err)
+	}
+	return f, info.Size(), nil
+}
+
+// GetSignature will return the content of ${path}.ed25519
+func (d *DirSource) GetSignature() ([64]byte, error) {
+	binary, err := d.binaryPath()
+	if err != nil {
+		return [64]byte{}, err
+	}
+
+	f, err := os.Open(binary + ".ed25519")
+	if err != nil {
+		return [64]byte{}, newSourceError("get signature", binary+".ed25519", err)
+	}
+	defer f.Close()
+
+	size := int64(-1)
+	if info, err := f.Stat(); err == nil {
+		size = info.Size()
+	}
+	r, err := readSignature(f, size)
+	if err != nil {
+		return [64]byte{}, newSourceError("get signature", binary+".ed25519", err)
+	}
+	return r, nil
+}
+
+// LatestVersion will return the release information of the manifest if present, otherwise the
+// modification time and size of the executable
+func (d *DirSource) LatestVersion() (*Version, error) {
+	manifest, binary, err := d.readManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	d.lock.Lock()
+	d.binary = binary
+	d.lock.Unlock()
+
+	info, err := os.Stat(binary)
+	if err != nil {
+		return nil, newSourceError("latest version", binary, err)
+	}
+
+	if manifest == nil {
+		return &Version{Date: info.ModTime(), Size: info.Size()}, nil
+	}
+	v := manifest.Release()
+	if v.Size == 0 {
+		v.Size = info.Size()
+	}
+	return v, nil
+}
+
+// Watch poll the directory at the specified interval and call back with the latest version
+// every time it changes from the one found when Watch was called, for example when a USB stick
+// with a new release is mounted. Calling the returned function stop watching.
+func (d *DirSource) Watch(interval time.Duration, callback func(*Version)) (stop func()) {
+	done := make(chan struct{})
+	var once sync.Once
+
+	last, _ := d.LatestVersion()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			v, err := d.LatestVersion()
+			if err != nil || sameRelease(v, last) {
+				continue
+			}
+			last = v
+			callback(v)
+		}
+	}()
+
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// binaryPath return the executable found by the last LatestVersion, looking it up if needed
+func (d *DirSource) binaryPath() (string, error) {
+	d.lock.Lock()
+	binary := d.binary
+	d.lock.Unlock()
+
+	if binary != "" {
+		return binary, nil
+	}
+
+	_, binary, err := d.readManifest()
+	if err != nil {
+		return "", err
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.binary = binary
+	return binary, nil
+}
+
+// readManifest return the manifest if one is configured and present, along with the path of the executable
+func (d *DirSource) readManifest() (*Manifest, string, error) {
+	if d.manifest == "" {
+		return nil, d.path, nil
+	}
+
+	content, err := os.ReadFile(d.manifest)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, d.path, nil
+	}
+	if err != nil {
+		return nil, "", newSourceError("latest version", d.manifest, err)
+	}
+
+	manifest := &Manifest{}
+	if err := json.Unmarshal(content, manifest); err != nil {
+		return nil, "", newSourceError("latest version", d.manifest, fmt.Errorf("%w: invalid manifest: %w", ErrNoVersion, err))
+	}
+	if manifest.URL == "" {
+		return manifest, d.path, nil
+	}
+
+	binary := localPath(manifest.URL)
+	if !filepath.IsAbs(binary) {
+		binary = filepath.Join(filepath.Dir(d.manifest), binary)
+	}
+	return manifest, binary, nil
+}
+
+// localPath resolve the platform template of a path and convert it from a file:// URL if needed
+func localPath(path string) string {
+	path = replaceURLTemplate(path)
+
+	u, err := url.Parse(path)
+	if err != nil || u.Scheme != "file" {
+		return path
+	}
+
+	path = u.Path
+	if runtime.GOOS == "windows" {
+		// file:///C:/dir/app.exe
+		path = strings.TrimPrefix(path, "/")
+	}
+	return filepath.FromSlash(path)
+}
+
+// sameRelease reports whether both versions describe the same release
+func sameRelease(a *Version, b *Version) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Number == b.Number && a.Build == b.Build && a.Date.Equal(b.Date) && a.Size == b.Size
+}
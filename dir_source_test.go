@@ -0,0 +1,102 @@
+package selfupdate
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeRelease(t *testing.T, path string, content []byte, date time.Time) {
+	// the release appear at once, as a watcher may be looking
+	assert.Nil(t, os.WriteFile(path+".ed25519", make([]byte, 64), 0644))
+	assert.Nil(t, os.WriteFile(path+".tmp", content, 0644))
+	assert.Nil(t, os.Chtimes(path+".tmp", date, date))
+	assert.Nil(t, os.Rename(path+".tmp", path))
+}
+
+func TestDirSource(t *testing.T) {
+	dir := t.TempDir()
+	date := time.Date(2022, 6, 22, 10, 0, 0, 0, time.UTC)
+	writeRelease(t, filepath.Join(dir, "app-"+runtime.GOOS), newFile, date)
+
+	source := NewDirSource("file://" + filepath.ToSlash(dir) + "/app-{{.OS}}")
+	version, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.True(t, date.Equal(version.Date))
+	assert.Equal(t, int64(len(newFile)), version.Size)
+
+	signature, err := source.GetSignature()
+	assert.Nil(t, err)
+	assert.Equal(t, [64]byte{}, signature)
+
+	r, size, err := source.Get(nil)
+	assert.Nil(t, err)
+	content, err := io.ReadAll(r)
+	r.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, content)
+	assert.Equal(t, int64(len(newFile)), size)
+
+	_, err = NewDirSource(filepath.Join(dir, "missing")).LatestVersion()
+	var se *SourceError
+	assert.True(t, errors.As(err, &se))
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+}
+
+func TestDirSourceManifest(t *testing.T) {
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "manifest.json")
+	source := NewDirSource(filepath.Join(dir, "app"), WithDirManifest(manifest))
+
+	// without manifest the executable modification time is used
+	writeRelease(t, filepath.Join(dir, "app"), []byte("old"), time.Date(2022, 6, 22, 10, 0, 0, 0, time.UTC))
+	version, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "", version.Number)
+
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "1.2.0"), 0755))
+	writeRelease(t, filepath.Join(dir, "1.2.0", "app-"+runtime.GOOS), newFile, time.Now())
+	assert.Nil(t, os.WriteFile(manifest, []byte(`{"version": "1.2.0", "critical": true, "url": "1.2.0/app-{{.OS}}"}`), 0644))
+
+	version, err = source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.0", version.Number)
+	assert.True(t, version.Critical)
+	assert.Equal(t, int64(len(newFile)), version.Size)
+
+	r, _, err := source.Get(version)
+	assert.Nil(t, err)
+	content, _ := io.ReadAll(r)
+	r.Close()
+	assert.Equal(t, newFile, content)
+
+	assert.Nil(t, os.WriteFile(manifest, []byte(`{"version": `), 0644))
+	_, err = source.LatestVersion()
+	assert.True(t, errors.Is(err, ErrNoVersion))
+}
+
+func TestDirSourceWatch(t *testing.T) {
+	dir := t.TempDir()
+	source := NewDirSource(filepath.Join(dir, "app"))
+
+	found := make(chan *Version, 1)
+	stop := source.Watch(5*time.Millisecond, func(v *Version) { found <- v })
+	defer stop()
+
+	date := time.Date(2022, 6, 22, 10, 0, 0, 0, time.UTC)
+	writeRelease(t, filepath.Join(dir, "app"), newFile, date)
+
+	select {
+	case v := <-found:
+		assert.True(t, date.Equal(v.Date))
+	case <-time.After(5 * time.Second):
+		t.Fatal("the new release was not noticed")
+	}
+}
@@ -0,0 +1,153 @@
+package selfupdate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+var (
+	// ErrNoUpdate is returned by a Source when it knows that there is no update available,
+	// CheckNow does not consider it a failure.
+	ErrNoUpdate = errors.New("no update available")
+	// ErrNoVersion is returned by a Source when the version information are missing
+	ErrNoVersion = errors.New("no version information available")
+	// ErrSignatureInvalid is returned when the signature does not match the update, it may have been tampered with
+	ErrSignatureInvalid = errors.New("invalid signature")
+	// ErrSignatureMalformed is returned when the signature could not be read or has an unexpected size
+	ErrSignatureMalformed = errors.New("malformed signature")
+	// ErrChecksumMismatch is returned when the checksum of the update is not the one expected, it may have been tampered with
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrInvalidPublicKey is returned when the public key is missing or does not match the verification algorithm
+	ErrInvalidPublicKey = errors.New("invalid public key")
+	// ErrMirrorInconsistent is returned by a MultiSource when a mirror does not serve the same version or signature as the others
+	ErrMirrorInconsistent = errors.New("inconsistent mirror")
+	// ErrHashUnavailable is returned when the requested hash function is not linked into the binary
+	ErrHashUnavailable = errors.New("requested hash function not available")
+	// ErrUpdateInProgress is returned by Updater.ApplyOnExit when a check or an install is running, the staged update is left in place
+	ErrUpdateInProgress = errors.New("update in progress")
+)
+
+// SourceError is returned by the Source provided in this package when they fail to reach
+// or read the update location.
+type SourceError struct {
+	Op         string // The operation that failed: "latest version", "get" or "get signature"
+	Location   string // The URL or path of the resource
+	StatusCode int    // The HTTP status code returned by the server, 0 if none
+	Err        error  // The underlying error
+}
+
+func (e *SourceError) Error() string {
+	msg := fmt.Sprintf("%s %s", e.Op, e.Location)
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(": status %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// Temporary reports whether the failure is transient and the operation may succeed if retried,
+// like a server error, too many requests, a timeout or a connection reset.
+func (e *SourceError) Temporary() bool {
+	switch {
+	case e.StatusCode >= 500, e.StatusCode == http.StatusTooManyRequests, e.StatusCode == http.StatusRequestTimeout:
+		return true
+	case e.StatusCode != 0:
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(e.Err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(e.Err, syscall.ECONNRESET) || errors.Is(e.Err, syscall.ECONNREFUSED) ||
+		errors.Is(e.Err, io.ErrUnexpectedEOF) || errors.Is(e.Err, io.EOF)
+}
+
+// NewSourceError wraps err in a SourceError for the Source implemented outside of this package,
+// picking the HTTP status code of errors that provide one with a HTTPStatusCode() int method.
+// A nil error is returned as is.
+func NewSourceError(op string, location string, err error) error {
+	return newSourceError(op, location, err)
+}
+
+// newSourceError wraps err in a SourceError, picking the HTTP status code of errors
+// that provide one like the AWS SDK response errors.
+func newSourceError(op string, location string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var se *SourceError
+	if errors.As(err, &se) {
+		return err
+	}
+
+	e := &SourceError{Op: op, Location: location, Err: err}
+	var status interface{ HTTPStatusCode() int }
+	if errors.As(err, &status) {
+		e.StatusCode = status.HTTPStatusCode()
+	}
+	return e
+}
+
+// ApplyStage identify the step of Apply that failed
+type ApplyStage int
+
+const (
+	// StagePrepare is the validation of the options
+	StagePrepare ApplyStage = iota
+	// StageRead is the reading of the update, including the download and the patch
+	StageRead
+	// StageVerify is the checksum and signature verification
+	StageVerify
+	// StageInstall is the replacement of the target file
+	StageInstall
+)
+
+// String return the name of the stage
+func (s ApplyStage) String() string {
+	switch s {
+	case StagePrepare:
+		return "prepare"
+	case StageRead:
+		return "read"
+	case StageVerify:
+		return "verify"
+	case StageInstall:
+		return "install"
+	}
+	return "unknown"
+}
+
+// ApplyError is returned by Apply and the Updater when applying an update failed
+type ApplyError struct {
+	Stage ApplyStage // The step that failed
+	Err   error      // The underlying error
+}
+
+func (e *ApplyError) Error() string {
+	return fmt.Sprintf("%s update: %v", e.Stage, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *ApplyError) Unwrap() error {
+	return e.Err
+}
+
+func newApplyError(stage ApplyStage, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ApplyError{Stage: stage, Err: err}
+}
@@ -0,0 +1,66 @@
+package selfupdate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type statusError int
+
+func (e statusError) Error() string       { return http.StatusText(int(e)) }
+func (e statusError) HTTPStatusCode() int { return int(e) }
+
+func TestSourceError(t *testing.T) {
+	err := newSourceError("get", "http://localhost/app", statusError(http.StatusServiceUnavailable))
+	var se *SourceError
+	assert.True(t, errors.As(err, &se))
+	assert.Equal(t, http.StatusServiceUnavailable, se.StatusCode)
+	assert.True(t, se.Temporary())
+	assert.Equal(t, "get http://localhost/app: status 503 Service Unavailable: Service Unavailable", err.Error())
+	assert.Equal(t, err, newSourceError("get signature", "http://localhost/app.ed25519", err))
+
+	assert.False(t, (&SourceError{StatusCode: http.StatusNotFound}).Temporary())
+	assert.True(t, (&SourceError{StatusCode: http.StatusTooManyRequests}).Temporary())
+	assert.True(t, (&SourceError{Err: fmt.Errorf("read: %w", syscall.ECONNRESET)}).Temporary())
+	assert.True(t, (&SourceError{Err: io.ErrUnexpectedEOF}).Temporary())
+	assert.False(t, (&SourceError{Err: ErrSignatureMalformed}).Temporary())
+	assert.Nil(t, newSourceError("get", "http://localhost/app", nil))
+}
+
+func TestApplyErrorUnwrap(t *testing.T) {
+	err := newApplyError(StageInstall, &rollbackErr{errors.New("rename failed"), syscall.EACCES})
+	assert.Equal(t, "install update: rename failed", err.Error())
+	assert.Equal(t, syscall.EACCES, RollbackError(err))
+
+	var applyErr *ApplyError
+	assert.True(t, errors.As(err, &applyErr))
+	assert.Equal(t, "install", applyErr.Stage.String())
+
+	assert.Nil(t, newApplyError(StageVerify, nil))
+	assert.True(t, errors.Is(newApplyError(StageVerify, fmt.Errorf("%w: ed25519", ErrSignatureInvalid)), ErrSignatureInvalid))
+}
+
+func TestReadSignature(t *testing.T) {
+	_, err := readSignature(io.LimitReader(zeroReader{}, 32), 32)
+	assert.True(t, errors.Is(err, ErrSignatureMalformed))
+
+	_, err = readSignature(io.LimitReader(zeroReader{}, 32), 64)
+	assert.True(t, errors.Is(err, ErrSignatureMalformed))
+
+	s, err := readSignature(io.LimitReader(zeroReader{}, 64), 64)
+	assert.Nil(t, err)
+	assert.Equal(t, [64]byte{}, s)
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
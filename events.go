@@ -0,0 +1,126 @@
+package selfupdate
+
+import (
+	"time"
+)
+
+// EventKind identify a stage of the update process
+type EventKind int
+
+const (
+	// EventCheckStarted is sent when a check for update start
+	EventCheckStarted EventKind = iota
+	// EventCheckFailed is sent when the latest version could not be determined
+	EventCheckFailed
+	// EventNoUpdate is sent when the current version is recent enough
+	EventNoUpdate
+	// EventUpdateFound is sent when a more recent version is available
+	EventUpdateFound
+	// EventUpdateDeclined is sent when the user didn't confirm the update
+	EventUpdateDeclined
+	// EventDownloadStarted is sent before the update start being downloaded
+	EventDownloadStarted
+	// EventDownloadCompleted is sent once the update has been fully downloaded
+	EventDownloadCompleted
+	// EventDownloadFailed is sent when the update or its signature could not be downloaded
+	EventDownloadFailed
+	// EventVerificationPassed is sent when the checksum and signature of the update are valid
+	EventVerificationPassed
+	// EventVerificationFailed is sent when the checksum or signature of the update are invalid
+	EventVerificationFailed
+	// EventInstalled is sent once the new executable has replaced the current one
+	EventInstalled
+	// EventInstallFailed is sent when the new executable could not replace the current one
+	EventInstallFailed
+	// EventRollback is sent when the current executable had to be restored after a failed install, Err is set if the rollback failed
+	EventRollback
+	// EventRestartPending is sent when the update is installed, but the application has not been restarted
+	EventRestartPending
+	// EventStaged is sent once the update has been downloaded and verified by Updater.Stage, to be installed later
+	EventStaged
+)
+
+var eventKindNames = [...]string{
+	EventCheckStarted:       "check_started",
+	EventCheckFailed:        "check_failed",
+	EventNoUpdate:           "no_update",
+	EventUpdateFound:        "update_found",
+	EventUpdateDeclined:     "update_declined",
+	EventDownloadStarted:    "download_started",
+	EventDownloadCompleted:  "download_completed",
+	EventDownloadFailed:     "download_failed",
+	EventVerificationPassed: "verification_passed",
+	EventVerificationFailed: "verification_failed",
+	EventInstalled:          "installed",
+	EventInstallFailed:      "install_failed",
+	EventRollback:           "rollback",
+	EventRestartPending:     "restart_pending",
+	EventStaged:             "staged",
+}
+
+// String return a stable name for the event kind, suitable for telemetry
+func (k EventKind) String() string {
+	if k < 0 || int(k) >= len(eventKindNames) {
+		return "unknown"
+	}
+	return eventKindNames[k]
+}
+
+// eventKindFromString return the event kind of a name returned by String, EventCheckStarted if unknown
+func eventKindFromString(name string) EventKind {
+	for kind, n := range eventKindNames {
+		if n == name {
+			return EventKind(kind)
+		}
+	}
+	return EventCheckStarted
+}
+
+// Event describe a stage of the update process
+type Event struct {
+	Kind    EventKind // The stage reached
+	Time    time.Time // When the stage was reached
+	Version *Version  // The version being checked or installed
+	Err     error     // The error that occurred at this stage, if any
+}
+
+// Observer defines an interface for receiving the events of the update process.
+// Events are delivered synchronously while the update is in progress, so OnEvent
+// should not block and must not call back into the Updater.
+type Observer interface {
+	OnEvent(Event)
+}
+
+// ObserverFunc will call the function to satisfy an Observer interface
+type ObserverFunc func(Event)
+
+// OnEvent calls fn(e)
+func (fn ObserverFunc) OnEvent(e Event) {
+	fn(e)
+}
+
+// AddObserver registers an Observer that will receive all future events of the Updater
+func (u *Updater) AddObserver(o Observer) {
+	u.observersLock.Lock()
+	defer u.observersLock.Unlock()
+
+	u.observers = append(u.observers, o)
+}
+
+func (u *Updater) emit(kind EventKind, v *Version, err error) {
+	e := Event{Kind: kind, Time: time.Now(), Version: v, Err: err}
+	u.recordEvent(e)
+	u.persistEvent(e)
+
+	if u.conf.Observer != nil {
+		u.conf.Observer.OnEvent(e)
+	}
+
+	u.observersLock.Lock()
+	observers := u.observers
+	u.observersLock.Unlock()
+
+	for _, o := range observers {
+		o.OnEvent(e)
+	}
+}
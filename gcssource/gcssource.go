@@ -0,0 +1,107 @@
+// Package gcssource provide a selfupdate.Source that will download the update from a Google Cloud
+// Storage bucket. It lives in its own package so that applications that do not use Google Cloud
+// do not depend on its SDK.
+//
+//	client, err := storage.NewClient(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	config := &selfupdate.Config{
+//		Source: gcssource.New(client, "mybucket", "myapp-{{.OS}}-{{.Arch}}{{.Ext}}"),
+//		...
+//	}
+package gcssource
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"cloud.google.com/go/storage"
+	"github.com/solodyagin/selfupdate"
+	"google.golang.org/api/googleapi"
+)
+
+// Source provide a selfupdate.Source that will download the update from a Google Cloud Storage bucket.
+// It is expecting the signature file to be stored at ${object}.ed25519
+type Source struct {
+	client *storage.Client
+	bucket string
+	object string
+}
+
+var _ selfupdate.Source = (*Source)(nil)
+
+// New provide a selfupdate.Source that will read the object named after the base in the bucket,
+// using the storage.Client provided. The base is a Go Template string that recognize the same
+// parameters as selfupdate.NewHTTPSource. To use an emulator like fake-gcs-server, create the
+// client with option.WithEndpoint or set STORAGE_EMULATOR_HOST.
+func New(client *storage.Client, bucket string, base string) selfupdate.Source {
+	return &Source{client: client, bucket: bucket, object: selfupdate.ExpandTemplate(base)}
+}
+
+// Get will return if it succeed an io.ReaderCloser to the new executable being downloaded and its length
+func (s *Source) Get(v *selfupdate.Version) (io.ReadCloser, int64, error) {
+	r, err := s.client.Bucket(s.bucket).Object(s.object).NewReader(context.Background())
+	if err != nil {
+		return nil, 0, selfupdate.NewSourceError("get", s.location(), gcsError(err))
+	}
+
+	return r, r.Attrs.Size, nil
+}
+
+// GetSignature will return the content of ${object}.ed25519
+func (s *Source) GetSignature() ([64]byte, error) {
+	r, err := s.client.Bucket(s.bucket).Object(s.object + ".ed25519").NewReader(context.Background())
+	if err != nil {
+		return [64]byte{}, selfupdate.NewSourceError("get signature", s.location()+".ed25519", gcsError(err))
+	}
+	defer r.Close()
+
+	signature, err := selfupdate.ReadSignature(r, r.Attrs.Size)
+	if err != nil {
+		return [64]byte{}, selfupdate.NewSourceError("get signature", s.location()+".ed25519", err)
+	}
+	return signature, nil
+}
+
+// LatestVersion will return the Updated time and the size of the executable
+func (s *Source) LatestVersion() (*selfupdate.Version, error) {
+	attrs, err := s.client.Bucket(s.bucket).Object(s.object).Attrs(context.Background())
+	if err != nil {
+		return nil, selfupdate.NewSourceError("latest version", s.location(), gcsError(err))
+	}
+
+	return &selfupdate.Version{Date: attrs.Updated, Size: attrs.Size}, nil
+}
+
+func (s *Source) location() string {
+	return "gs://" + s.bucket + "/" + s.object
+}
+
+// statusError attach the HTTP status code of a storage error for selfupdate.NewSourceError
+type statusError struct {
+	error
+	code int
+}
+
+func (e *statusError) HTTPStatusCode() int {
+	return e.code
+}
+
+func (e *statusError) Unwrap() error {
+	return e.error
+}
+
+func gcsError(err error) error {
+	if errors.Is(err, storage.ErrObjectNotExist) || errors.Is(err, storage.ErrBucketNotExist) {
+		return &statusError{error: err, code: http.StatusNotFound}
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return &statusError{error: err, code: apiErr.Code}
+	}
+	return err
+}
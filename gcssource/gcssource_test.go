@@ -0,0 +1,95 @@
+package gcssource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/solodyagin/selfupdate"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+)
+
+var newFile = []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+
+// gcsServer serves the objects of a single bucket the way the JSON API of Cloud Storage does,
+// for metadata and media requests
+func gcsServer(t *testing.T, bucket string, objects map[string][]byte, updated time.Time) *storage.Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := strings.CutPrefix(r.URL.Path, "/storage/v1/b/"+bucket+"/o/")
+		content, found := objects[name]
+		if !ok || !found {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"error": {"code": 404, "message": "Not Found"}}`)
+			return
+		}
+
+		if r.URL.Query().Get("alt") == "media" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Header().Set("X-Goog-Generation", "1")
+			w.Write(content)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"bucket":     bucket,
+			"name":       name,
+			"size":       strconv.Itoa(len(content)),
+			"updated":    updated.Format(time.RFC3339),
+			"generation": "1",
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := storage.NewClient(context.Background(), option.WithEndpoint(server.URL+"/storage/v1/"),
+		option.WithoutAuthentication(), storage.WithJSONReads())
+	assert.Nil(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestSource(t *testing.T) {
+	updated := time.Date(2022, 6, 22, 10, 0, 0, 0, time.UTC)
+	client := gcsServer(t, "releases", map[string][]byte{
+		"app-" + runtime.GOOS:              newFile,
+		"app-" + runtime.GOOS + ".ed25519": make([]byte, 64),
+	}, updated)
+
+	source := New(client, "releases", "app-{{.OS}}")
+	version, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.True(t, updated.Equal(version.Date))
+	assert.Equal(t, int64(len(newFile)), version.Size)
+
+	signature, err := source.GetSignature()
+	assert.Nil(t, err)
+	assert.Equal(t, [64]byte{}, signature)
+
+	r, size, err := source.Get(version)
+	assert.Nil(t, err)
+	content, err := io.ReadAll(r)
+	r.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, content)
+	assert.Equal(t, int64(len(newFile)), size)
+
+	_, err = New(client, "releases", "missing").LatestVersion()
+	var se *selfupdate.SourceError
+	assert.True(t, errors.As(err, &se))
+	assert.Equal(t, "gs://releases/missing", se.Location)
+	assert.Equal(t, http.StatusNotFound, se.StatusCode)
+
+	_, err = New(client, "unknown", "app").GetSignature()
+	assert.True(t, errors.As(err, &se))
+	assert.Equal(t, http.StatusNotFound, se.StatusCode)
+}
@@ -1,21 +1,39 @@
 package selfupdate
 
 import (
-	"bytes"
-	"errors"
+	"encoding/json"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
 )
 
 // HTTPSource provide a Source that will download the update from a HTTP url.
 // It is expecting the signature file to be served at ${URL}.ed25519
 type HTTPSource struct {
-	client  *http.Client
-	baseURL string
+	client        *http.Client
+	baseURL       string
+	retry         RetryPolicy
+	versionHeader string
+	cachePath     string
+
+	lock       sync.Mutex
+	installed  *httpValidators
+	downloaded *httpValidators // of the last executable downloaded by Get
+}
+
+// httpValidators are the ETag and Last-Modified of the installed version, used for conditional requests
+type httpValidators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
 }
 
 var _ Source = (*HTTPSource)(nil)
+var _ InstallRecorder = (*HTTPSource)(nil)
 
 type platform struct {
 	OS         string
@@ -24,6 +42,43 @@ type platform struct {
 	Executable string
 }
 
+// RetryPolicy define how transient failures (server errors, too many requests, timeouts
+// and connection resets) are retried with a jittered exponential backoff.
+type RetryPolicy struct {
+	MaxAttempts    int           // Number of attempts including the first one, 1 disable retries
+	InitialBackoff time.Duration // Delay before the first retry, doubled for each following retry
+	MaxBackoff     time.Duration // Maximum delay between two attempts, including the one requested by a Retry-After header
+}
+
+// DefaultRetryPolicy is used when no RetryPolicy is specified, and for each field of a RetryPolicy
+// left to zero or set to a negative value
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, InitialBackoff: 500 * time.Millisecond, MaxBackoff: 30 * time.Second}
+
+// HTTPSourceOption configure an HTTP based Source
+type HTTPSourceOption func(*HTTPSource)
+
+// WithRetryPolicy specify how transient failures are retried instead of DefaultRetryPolicy
+func WithRetryPolicy(policy RetryPolicy) HTTPSourceOption {
+	return func(h *HTTPSource) {
+		h.retry = policy
+	}
+}
+
+// WithVersionHeader read the version number from the specified response header, like X-Version, when it is served
+func WithVersionHeader(name string) HTTPSourceOption {
+	return func(h *HTTPSource) {
+		h.versionHeader = name
+	}
+}
+
+// WithValidatorCache persist the ETag and Last-Modified of the installed version in the specified
+// file, so that the version checks send conditional requests even after the application restarted
+func WithValidatorCache(path string) HTTPSourceOption {
+	return func(h *HTTPSource) {
+		h.cachePath = path
+	}
+}
+
 // NewHTTPSource provide a selfupdate.Source that will fetch the specified base URL
 // for update and signature using the http.Client provided. To help into providing
 // cross platform application, the base is actually a Go Template string where the
@@ -34,80 +89,248 @@ type platform struct {
 // As an example the following string `http://localhost/myapp-{{.OS}}-{{.Arch}}{{.Ext}}`
 // would fetch on Windows AMD64 the following URL: `http://localhost/myapp-windows-amd64.exe`
 // and on Linux AMD64: `http://localhost/myapp-linux-amd64`.
-func NewHTTPSource(client *http.Client, base string) Source {
+func NewHTTPSource(client *http.Client, base string, opts ...HTTPSourceOption) Source {
+	return newHTTPSource(client, replaceURLTemplate(base), opts)
+}
+
+func newHTTPSource(client *http.Client, url string, opts []HTTPSourceOption) *HTTPSource {
 	if client == nil {
 		client = http.DefaultClient
 	}
 
-	base = replaceURLTemplate(base)
-
-	return &HTTPSource{client: client, baseURL: base}
+	h := &HTTPSource{client: client, baseURL: url}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
-// Get will return if it succeed an io.ReaderCloser to the new executable being downloaded and its length
+// Get will return if it succeed an io.ReaderCloser to the new executable being downloaded and its length.
+// If the server answer 304 Not Modified, the returned error match ErrNoUpdate.
 func (h *HTTPSource) Get(v *Version) (io.ReadCloser, int64, error) {
-	request, err := http.NewRequest("GET", h.baseURL, nil)
-	if err != nil {
-		return nil, 0, err
-	}
-
+	header := h.conditionalHeader()
 	if v != nil && !v.Date.IsZero() {
-		request.Header.Add("If-Modified-Since", v.Date.Format(http.TimeFormat))
-
+		header.Set("If-Modified-Since", v.Date.Format(http.TimeFormat))
 	}
 
-	response, err := h.client.Do(request)
+	response, err := h.do("get", http.MethodGet, h.baseURL, header)
 	if err != nil {
 		return nil, 0, err
 	}
 
+	h.lock.Lock()
+	h.downloaded = &httpValidators{ETag: response.Header.Get("ETag"), LastModified: response.Header.Get("Last-Modified")}
+	h.lock.Unlock()
+
 	return response.Body, response.ContentLength, nil
 }
 
 // GetSignature will return the content of  ${URL}.ed25519
 func (h *HTTPSource) GetSignature() ([64]byte, error) {
-	resp, err := h.client.Get(h.baseURL + ".ed25519")
+	resp, err := h.do("get signature", http.MethodGet, h.baseURL+".ed25519", nil)
 	if err != nil {
 		return [64]byte{}, err
 	}
 	defer resp.Body.Close()
 
-	if resp.ContentLength != 64 {
-		return [64]byte{}, fmt.Errorf("ed25519 signature must be 64 bytes long and was %v", resp.ContentLength)
+	r, err := readSignature(resp.Body, resp.ContentLength)
+	if err != nil {
+		return [64]byte{}, newSourceError("get signature", h.baseURL+".ed25519", err)
 	}
+	return r, nil
+}
 
-	writer := bytes.NewBuffer(make([]byte, 0, 64))
-	n, err := io.Copy(writer, resp.Body)
+// LatestVersion will return the URL Last-Modified time, ETag, the version number from the version
+// header if configured and the size of the executable if known. The request is conditional to the
+// ETag and Last-Modified of the installed version and a 304 Not Modified is reported as ErrNoUpdate.
+func (h *HTTPSource) LatestVersion() (*Version, error) {
+	resp, err := h.do("latest version", http.MethodHead, h.baseURL, h.conditionalHeader())
 	if err != nil {
-		return [64]byte{}, err
+		return nil, err
 	}
+	resp.Body.Close()
 
-	if n != 64 {
-		return [64]byte{}, fmt.Errorf("ed25519 signature must be 64 bytes long and was %v", n)
+	v := &Version{ETag: resp.Header.Get("ETag"), Size: max(resp.ContentLength, 0)}
+	if h.versionHeader != "" {
+		v.Number = resp.Header.Get(h.versionHeader)
 	}
 
-	r := [64]byte{}
-	copy(r[:], writer.Bytes())
+	lastModified := resp.Header.Get("Last-Modified")
+	switch {
+	case lastModified != "":
+		v.Date, err = http.ParseTime(lastModified)
+		if err != nil {
+			return nil, newSourceError("latest version", h.baseURL, fmt.Errorf("%w: %w", ErrNoVersion, err))
+		}
+	case v.Number == "":
+		return nil, newSourceError("latest version", h.baseURL, fmt.Errorf("%w: no Last-Modified served", ErrNoVersion))
+	}
 
-	return r, nil
+	return v, nil
 }
 
-// LatestVersion will return the URL Last-Modified time
-func (h *HTTPSource) LatestVersion() (*Version, error) {
-	resp, err := h.client.Head(h.baseURL)
+// RecordInstall remember the ETag and Last-Modified of the installed version for the next
+// conditional requests, and persist them if a validator cache is configured.
+func (h *HTTPSource) RecordInstall(v *Version) error {
+	installed := &httpValidators{ETag: v.ETag}
+	if !v.Date.IsZero() {
+		installed.LastModified = v.Date.UTC().Format(http.TimeFormat)
+	}
+	return h.record(installed)
+}
+
+// recordDownload remember the ETag and Last-Modified of the last executable downloaded by Get as
+// the ones of the installed version, for a Source that does not get them from LatestVersion
+func (h *HTTPSource) recordDownload() error {
+	h.lock.Lock()
+	downloaded := h.downloaded
+	h.lock.Unlock()
+
+	if downloaded == nil {
+		return nil
+	}
+	return h.record(downloaded)
+}
+
+func (h *HTTPSource) record(installed *httpValidators) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.installed = installed
+	if h.cachePath == "" {
+		return nil
+	}
+
+	content, err := json.Marshal(installed)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	return writeFileAtomic(h.cachePath, content, 0600)
+}
 
-	lastModified := resp.Header.Get("Last-Modified")
-	if lastModified == "" {
-		return nil, errors.New("no Last-Modified served")
+// conditionalHeader return the If-None-Match and If-Modified-Since header matching the installed version
+func (h *HTTPSource) conditionalHeader() http.Header {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.installed == nil {
+		h.installed = &httpValidators{}
+		if h.cachePath != "" {
+			if content, err := os.ReadFile(h.cachePath); err == nil {
+				// a corrupted cache only cost an unconditional request
+				_ = json.Unmarshal(content, h.installed)
+			}
+		}
+	}
+
+	header := http.Header{}
+	if h.installed.ETag != "" {
+		header.Set("If-None-Match", h.installed.ETag)
 	}
+	if h.installed.LastModified != "" {
+		header.Set("If-Modified-Since", h.installed.LastModified)
+	}
+	return header
+}
+
+// Do send a request with the client, retry policy and options of the source, for the Source
+// implemented on top of HTTP outside of this package. It only returns a response for a successful
+// status, a 304 Not Modified is reported as ErrNoUpdate and any other status as a SourceError for op.
+func (h *HTTPSource) Do(op string, method string, url string, header http.Header) (*http.Response, error) {
+	return h.do(op, method, url, header)
+}
+
+// do send the request, retrying transient failures according to the retry policy. It only
+// returns a response for a successful status, a 304 Not Modified is reported as ErrNoUpdate
+// and any other status as a SourceError.
+func (h *HTTPSource) do(op string, method string, url string, header http.Header) (*http.Response, error) {
+	policy := h.retry.withDefaults()
+
+	for attempt := 1; ; attempt++ {
+		resp, err := h.send(op, method, url, header)
+		if err == nil {
+			return resp, nil
+		}
+
+		se, ok := err.(*SourceError)
+		if !ok || !se.Temporary() || attempt >= policy.MaxAttempts {
+			return nil, err
+		}
+
+		delay := policy.backoff(attempt)
+		if resp != nil {
+			if after, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+				delay = min(after, policy.MaxBackoff)
+			}
+		}
+		time.Sleep(delay)
+	}
+}
 
-	t, err := http.ParseTime(lastModified)
+// send a single request, the response is returned along with the error for an unexpected status
+// so that its headers can be inspected, but its body is already closed.
+func (h *HTTPSource) send(op string, method string, url string, header http.Header) (*http.Response, error) {
+	request, err := http.NewRequest(method, url, nil)
 	if err != nil {
-		return nil, err
+		return nil, newSourceError(op, url, err)
+	}
+	for k, v := range header {
+		request.Header[k] = v
+	}
+
+	resp, err := h.client.Do(request)
+	if err != nil {
+		return nil, newSourceError(op, url, err)
+	}
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return resp, nil
+	case resp.StatusCode == http.StatusNotModified:
+		resp.Body.Close()
+		return resp, &SourceError{Op: op, Location: url, StatusCode: resp.StatusCode, Err: ErrNoUpdate}
+	}
+
+	// drain a bit of the error page to allow the connection to be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+	return resp, &SourceError{Op: op, Location: url, StatusCode: resp.StatusCode}
+}
+
+// withDefaults return the policy with the fields that are not set taken from DefaultRetryPolicy
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	}
+	return p
+}
+
+// backoff return the jittered delay before the retry following the attempt
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff << (attempt - 1)
+	if d <= 0 || d > p.MaxBackoff {
+		d = p.MaxBackoff
 	}
+	// pick a random delay between half and the full backoff
+	return d/2 + rand.N(d/2+1)
+}
 
-	return &Version{Date: t}, nil
+// retryAfter parse a Retry-After header expressed in seconds or as an HTTP date
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
 }
@@ -1,10 +1,15 @@
 package selfupdate
 
 import (
+	"bytes"
 	"crypto/ed25519"
+	"errors"
 	"io"
 	"log"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"runtime"
 	"testing"
 	"time"
@@ -66,3 +71,173 @@ func TestReplaceURLTemplate(t *testing.T) {
 	assert.NotEqual(t, change, r)
 	assert.Equal(t, expected, r)
 }
+
+// faultServer serves newFile, its signature and Last-Modified after failing the first requests with the given faults
+func faultServer(t *testing.T, faults ...func(w http.ResponseWriter, r *http.Request)) (*httptest.Server, *int) {
+	requests := 0
+	lastModified := time.Date(2022, 6, 22, 10, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= len(faults) {
+			faults[requests-1](w, r)
+			return
+		}
+
+		if r.URL.Path == "/app.ed25519" {
+			w.Write(make([]byte, 64))
+			return
+		}
+		http.ServeContent(w, r, "app", lastModified, bytes.NewReader(newFile))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func status(code int, header ...string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i+1 < len(header); i += 2 {
+			w.Header().Set(header[i], header[i+1])
+		}
+		http.Error(w, "<html>error page</html>", code)
+	}
+}
+
+func reset(w http.ResponseWriter, r *http.Request) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err == nil {
+		conn.Close()
+	}
+}
+
+var fastRetry = WithRetryPolicy(RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond})
+
+func TestHTTPSourceRetry(t *testing.T) {
+	server, requests := faultServer(t, status(http.StatusInternalServerError), reset, status(http.StatusTooManyRequests, "Retry-After", "1"))
+	source := NewHTTPSource(server.Client(), server.URL+"/app", fastRetry)
+
+	start := time.Now()
+	body, contentLength, err := source.Get(nil)
+	assert.Nil(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, 4, *requests)
+	assert.Equal(t, int64(len(newFile)), contentLength)
+	content, err := io.ReadAll(body)
+	body.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, content)
+}
+
+func TestHTTPSourceRetryExhausted(t *testing.T) {
+	server, requests := faultServer(t, status(http.StatusBadGateway), status(http.StatusBadGateway), status(http.StatusBadGateway), status(http.StatusBadGateway))
+	source := NewHTTPSource(server.Client(), server.URL+"/app", fastRetry)
+
+	_, err := source.GetSignature()
+	var se *SourceError
+	assert.True(t, errors.As(err, &se))
+	assert.Equal(t, http.StatusBadGateway, se.StatusCode)
+	assert.Equal(t, 4, *requests)
+}
+
+func TestHTTPSourceStatus(t *testing.T) {
+	server, requests := faultServer(t, status(http.StatusNotFound), status(http.StatusForbidden))
+	source := NewHTTPSource(server.Client(), server.URL+"/app", fastRetry)
+
+	_, _, err := source.Get(nil)
+	var se *SourceError
+	assert.True(t, errors.As(err, &se))
+	assert.Equal(t, http.StatusNotFound, se.StatusCode)
+	assert.False(t, se.Temporary())
+	assert.Equal(t, 1, *requests)
+
+	_, err = source.LatestVersion()
+	assert.True(t, errors.As(err, &se))
+	assert.Equal(t, http.StatusForbidden, se.StatusCode)
+
+	version, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2022, 6, 22, 10, 0, 0, 0, time.UTC), version.Date)
+	assert.Equal(t, int64(len(newFile)), version.Size)
+
+	_, _, err = source.Get(&Version{Date: version.Date})
+	assert.True(t, errors.Is(err, ErrNoUpdate))
+}
+
+func TestRetryAfter(t *testing.T) {
+	d, ok := retryAfter("3")
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, d)
+
+	d, ok = retryAfter(time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat))
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), d)
+
+	_, ok = retryAfter("soon")
+	assert.False(t, ok)
+
+	policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt := 1; attempt < 10; attempt++ {
+		d := policy.backoff(attempt)
+		assert.LessOrEqual(t, d, time.Second)
+		assert.GreaterOrEqual(t, d, min(policy.InitialBackoff<<(attempt-1), time.Second)/2)
+	}
+}
+
+func TestRetryPolicyDefaults(t *testing.T) {
+	assert.Equal(t, DefaultRetryPolicy, RetryPolicy{}.withDefaults())
+	assert.Equal(t, RetryPolicy{MaxAttempts: 5, InitialBackoff: DefaultRetryPolicy.InitialBackoff, MaxBackoff: DefaultRetryPolicy.MaxBackoff},
+		RetryPolicy{MaxAttempts: 5}.withDefaults())
+	assert.Equal(t, RetryPolicy{MaxAttempts: DefaultRetryPolicy.MaxAttempts, InitialBackoff: time.Millisecond, MaxBackoff: DefaultRetryPolicy.MaxBackoff},
+		RetryPolicy{InitialBackoff: time.Millisecond}.withDefaults())
+	assert.Equal(t, DefaultRetryPolicy, RetryPolicy{MaxAttempts: -1, InitialBackoff: -time.Second, MaxBackoff: -time.Second}.withDefaults())
+
+	// a partially specified policy still wait between attempts
+	server, requests := faultServer(t, status(http.StatusInternalServerError))
+	source := NewHTTPSource(server.Client(), server.URL+"/app", WithRetryPolicy(RetryPolicy{MaxAttempts: 2, MaxBackoff: -time.Second, InitialBackoff: time.Millisecond}))
+	_, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, *requests)
+}
+
+func TestHTTPSourceConditional(t *testing.T) {
+	etag := `"v1"`
+	var ifNoneMatch string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifNoneMatch = r.Header.Get("If-None-Match")
+		w.Header().Set("ETag", etag)
+		w.Header().Set("X-Version", "1.2.0")
+		http.ServeContent(w, r, "app", time.Date(2022, 6, 22, 10, 0, 0, 0, time.UTC), bytes.NewReader(newFile))
+	}))
+	defer server.Close()
+
+	cache := filepath.Join(t.TempDir(), "validators.json")
+	source := NewHTTPSource(server.Client(), server.URL+"/app", WithVersionHeader("X-Version"), WithValidatorCache(cache))
+
+	version, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.0", version.Number)
+	assert.Equal(t, `"v1"`, version.ETag)
+	assert.Equal(t, "", ifNoneMatch)
+
+	assert.Nil(t, source.(InstallRecorder).RecordInstall(version))
+	_, err = source.LatestVersion()
+	assert.True(t, errors.Is(err, ErrNoUpdate))
+	assert.Equal(t, `"v1"`, ifNoneMatch)
+
+	// the validators survive a restart
+	source = NewHTTPSource(server.Client(), server.URL+"/app", WithValidatorCache(cache))
+	_, _, err = source.Get(nil)
+	assert.True(t, errors.Is(err, ErrNoUpdate))
+
+	etag = `"v2"`
+	version, err = source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, `"v2"`, version.ETag)
+
+	// a corrupted cache only cost an unconditional request
+	assert.Nil(t, os.WriteFile(cache, []byte("{corrupted"), 0600))
+	etag = `"v1"`
+	source = NewHTTPSource(server.Client(), server.URL+"/app", WithValidatorCache(cache))
+	_, err = source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "", ifNoneMatch)
+}
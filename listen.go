@@ -0,0 +1,170 @@
+package selfupdate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+)
+
+const (
+	// listenersEnv describe the listeners inherited from the previous process, starting at file descriptor 3
+	listenersEnv = "SELFUPDATE_LISTENERS"
+	// readyEnv is the file descriptor to write to once the new process is ready to serve
+	readyEnv = "SELFUPDATE_READY_FD"
+)
+
+// handoffListener is a listener created by Listen, passed to the new process by RestartGraceful
+type handoffListener struct {
+	Network string `json:"network"`
+	Addr    string `json:"addr"`
+
+	listener net.Listener
+	fd       int // file descriptor of an inherited listener not claimed by Listen yet, 0 otherwise
+}
+
+var handoff struct {
+	sync.Mutex
+	loaded    bool
+	inherited []*handoffListener
+	listeners []*handoffListener
+}
+
+// Listen announces on the local network address like net.Listen, but reuse the listener passed
+// by the previous process when the application was restarted with RestartGraceful. The listener
+// is matched by the network and address given to Listen, so an address like ":0" keeps the port
+// chosen at the first start. Only TCP and Unix listeners can be passed to the new process.
+func Listen(network string, addr string) (net.Listener, error) {
+	handoff.Lock()
+	defer handoff.Unlock()
+
+	loadInherited()
+
+	l := &handoffListener{Network: network, Addr: addr}
+	for _, inherited := range handoff.inherited {
+		if inherited.fd == 0 || inherited.Network != network || inherited.Addr != addr {
+			continue
+		}
+
+		f := os.NewFile(uintptr(inherited.fd), network+":"+addr)
+		inherited.fd = 0
+		listener, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("inherited listener %s %s: %w", network, addr, err)
+		}
+		l.listener = listener
+		break
+	}
+
+	if l.listener == nil {
+		listener, err := net.Listen(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		l.listener = listener
+	}
+
+	handoff.listeners = append(handoff.listeners, l)
+	return l.listener, nil
+}
+
+// Ready tells the process that started this one with RestartGraceful that it is ready to serve,
+// so that it can stop accepting connections and drain the ones in progress. It does nothing
+// if the application was not started by a graceful restart.
+func Ready() error {
+	value := os.Getenv(readyEnv)
+	if value == "" {
+		return nil
+	}
+	os.Unsetenv(readyEnv)
+
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", readyEnv, err)
+	}
+
+	f := os.NewFile(uintptr(fd), "ready")
+	defer f.Close()
+	_, err = f.Write([]byte{1})
+	return err
+}
+
+// loadInherited read the description of the listeners passed by the previous process, once
+func loadInherited() {
+	if handoff.loaded {
+		return
+	}
+	handoff.loaded = true
+
+	value := os.Getenv(listenersEnv)
+	if value == "" {
+		return
+	}
+	os.Unsetenv(listenersEnv)
+
+	// a process not started by a graceful restart would not have those file descriptors
+	if err := json.Unmarshal([]byte(value), &handoff.inherited); err != nil {
+		handoff.inherited = nil
+		return
+	}
+	for i, l := range handoff.inherited {
+		l.fd = 3 + i
+	}
+}
+
+// handoffFiles return the files of the listeners to pass to the new process along with their description
+func handoffFiles() ([]*os.File, string, error) {
+	handoff.Lock()
+	defer handoff.Unlock()
+
+	var files []*os.File
+	var described []*handoffListener
+	for _, l := range handoff.listeners {
+		filer, ok := l.listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			closeFiles(files)
+			return nil, "", fmt.Errorf("listener %s %s can not be passed to a new process", l.Network, l.Addr)
+		}
+
+		f, err := filer.File()
+		if errors.Is(err, net.ErrClosed) {
+			continue
+		}
+		if err != nil {
+			closeFiles(files)
+			return nil, "", fmt.Errorf("listener %s %s: %w", l.Network, l.Addr, err)
+		}
+		files = append(files, f)
+		described = append(described, l)
+	}
+
+	content, err := json.Marshal(described)
+	if err != nil {
+		closeFiles(files)
+		return nil, "", err
+	}
+	return files, string(content), nil
+}
+
+// keepUnixSockets prevent the socket files of the listeners to be removed when they are closed,
+// as the new process is now serving them
+func keepUnixSockets() {
+	handoff.Lock()
+	defer handoff.Unlock()
+
+	for _, l := range handoff.listeners {
+		if unix, ok := l.listener.(*net.UnixListener); ok {
+			unix.SetUnlinkOnClose(false)
+		}
+	}
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
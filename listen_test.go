@@ -0,0 +1,111 @@
+//go:build linux
+// +build linux
+
+package selfupdate
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestGracefulRestartHelper is run as a child process by TestGracefulRestart, it serves its PID
+// over HTTP and restart gracefully when asked to
+func TestGracefulRestartHelper(t *testing.T) {
+	if os.Getenv("SELFUPDATE_TEST_GRACEFUL") == "" {
+		t.Skip("only run by TestGracefulRestart")
+	}
+
+	l, err := Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &http.Server{}
+	done := make(chan struct{})
+	shutdown := func(error) {
+		server.Shutdown(context.Background())
+		close(done)
+	}
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, os.Getpid())
+	})
+	http.HandleFunc("/restart", func(w http.ResponseWriter, r *http.Request) {
+		executable, _ := os.Executable()
+		go restart(&Config{RestartStrategy: RestartGraceful, ExitCallback: shutdown}, executable)
+	})
+	http.HandleFunc("/quit", func(w http.ResponseWriter, r *http.Request) {
+		go shutdown(nil)
+	})
+
+	fmt.Printf("listening %s %d\n", l.Addr(), os.Getpid())
+	go server.Serve(l)
+	Ready()
+	<-done
+}
+
+func TestGracefulRestart(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestGracefulRestartHelper$")
+	cmd.Env = append(os.Environ(), "SELFUPDATE_TEST_GRACEFUL=1")
+	stdout, err := cmd.StdoutPipe()
+	assert.Nil(t, err)
+	assert.Nil(t, cmd.Start())
+	t.Cleanup(func() { cmd.Process.Kill() })
+
+	var addr string
+	var parent int
+	_, err = fmt.Fscanf(bufio.NewReader(stdout), "listening %s %d\n", &addr, &parent)
+	assert.Nil(t, err)
+	go io.Copy(io.Discard, stdout)
+
+	// http.Server.Shutdown closes a connection accepted concurrently without answering it, a
+	// client retries such a request as it was not processed
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	get := func(path string) (int, error) {
+		resp, err := client.Get("http://" + addr + path)
+		if errors.Is(err, io.EOF) {
+			resp, err = client.Get("http://" + addr + path)
+		}
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		pid, _ := strconv.Atoi(string(body))
+		return pid, nil
+	}
+
+	pid, err := get("/")
+	assert.Nil(t, err)
+	assert.Equal(t, parent, pid)
+
+	_, err = get("/restart")
+	assert.Nil(t, err)
+
+	// no connection is refused while the new process takes over
+	deadline := time.Now().Add(10 * time.Second)
+	for pid == parent && time.Now().Before(deadline) {
+		pid, err = get("/")
+		if !assert.Nil(t, err) {
+			return
+		}
+	}
+	assert.NotEqual(t, parent, pid)
+	assert.NotZero(t, pid)
+
+	// the parent exits once the new process is ready
+	assert.Nil(t, cmd.Wait())
+
+	_, err = get("/quit")
+	assert.Nil(t, err)
+}
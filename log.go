@@ -1,5 +1,12 @@
 package selfupdate
 
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
 // LogError will be called to log any reason that have prevented an executable update
 var LogError func(string, ...any)
 
@@ -29,3 +36,102 @@ func logDebug(format string, p ...any) {
 	}
 	LogDebug(format, p...)
 }
+
+// hookLogger forward structured records to LogError, LogInfo and LogDebug when no Logger is configured
+var hookLogger = slog.New(&hookHandler{})
+
+func (u *Updater) logger() *slog.Logger {
+	if u.conf.Logger != nil {
+		return u.conf.Logger
+	}
+	return hookLogger
+}
+
+// hookHandler is a slog.Handler that format records as `message key=value ...` lines
+// and pass them to the package wide log functions matching the record level.
+type hookHandler struct {
+	attrs []slog.Attr
+	group string
+}
+
+var _ slog.Handler = (*hookHandler)(nil)
+
+func (h *hookHandler) Enabled(_ context.Context, level slog.Level) bool {
+	switch {
+	case level >= slog.LevelError:
+		return LogError != nil
+	case level >= slog.LevelInfo:
+		return LogInfo != nil
+	default:
+		return LogDebug != nil
+	}
+}
+
+func (h *hookHandler) Handle(_ context.Context, r slog.Record) error {
+	format := &strings.Builder{}
+	format.WriteString(strings.ReplaceAll(r.Message, "%", "%%"))
+
+	p := []any{}
+	for _, a := range h.attrs {
+		p = appendHookAttr(format, p, "", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		p = appendHookAttr(format, p, h.group, a)
+		return true
+	})
+	format.WriteString("\n")
+
+	switch {
+	case r.Level >= slog.LevelError:
+		logError(format.String(), p...)
+	case r.Level >= slog.LevelInfo:
+		logInfo(format.String(), p...)
+	default:
+		logDebug(format.String(), p...)
+	}
+	return nil
+}
+
+func (h *hookHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	grouped := make([]slog.Attr, 0, len(h.attrs)+len(attrs))
+	grouped = append(grouped, h.attrs...)
+	for _, a := range attrs {
+		if h.group != "" {
+			a.Key = h.group + "." + a.Key
+		}
+		grouped = append(grouped, a)
+	}
+	return &hookHandler{attrs: grouped, group: h.group}
+}
+
+func (h *hookHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	if h.group != "" {
+		name = h.group + "." + name
+	}
+	return &hookHandler{attrs: h.attrs, group: name}
+}
+
+func appendHookAttr(format *strings.Builder, p []any, group string, a slog.Attr) []any {
+	v := a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return p
+	}
+
+	key := a.Key
+	if group != "" && key != "" {
+		key = group + "." + key
+	}
+
+	if v.Kind() == slog.KindGroup {
+		for _, ga := range v.Group() {
+			p = appendHookAttr(format, p, key, ga)
+		}
+		return p
+	}
+
+	fmt.Fprintf(format, " %s=%%v", strings.ReplaceAll(key, "%", "%%"))
+	return append(p, v.Any())
+}
@@ -1,6 +1,11 @@
 package selfupdate
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -41,3 +46,62 @@ func TestLog(t *testing.T) {
 	logDebug("debug")
 	assert.True(t, debugCalled)
 }
+
+type recordHandler struct {
+	records *[]slog.Record
+}
+
+func (h recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h recordHandler) Handle(_ context.Context, r slog.Record) error {
+	*h.records = append(*h.records, r)
+	return nil
+}
+func (h recordHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h recordHandler) WithGroup(string) slog.Handler      { return h }
+
+func recordAttrs(r slog.Record) map[string]slog.Value {
+	attrs := map[string]slog.Value{}
+	r.Attrs(func(a slog.Attr) bool {
+		attrs[a.Key] = a.Value.Resolve()
+		return true
+	})
+	return attrs
+}
+
+func TestUpdaterLogger(t *testing.T) {
+	records := []slog.Record{}
+	source := &testSource{version: &Version{Number: "1.0.0"}}
+	u := &Updater{conf: &Config{
+		Current:   &Version{Number: "1.0.0"},
+		Source:    source,
+		Logger:    slog.New(recordHandler{records: &records}),
+		StatePath: filepath.Join(t.TempDir(), "state.json"),
+	}}
+
+	assert.Nil(t, u.CheckNow())
+	last := records[len(records)-1]
+	assert.Equal(t, slog.LevelDebug, last.Level)
+	attrs := recordAttrs(last)
+	assert.Equal(t, "1.0.0", attrs["latest"].Group()[0].Value.String())
+	assert.Contains(t, attrs, "duration")
+
+	source.err = errors.New("unreachable")
+	assert.NotNil(t, u.CheckNow())
+	last = records[len(records)-1]
+	assert.Equal(t, slog.LevelError, last.Level)
+	assert.Equal(t, source.err, recordAttrs(last)["error"].Any())
+}
+
+func TestHookLogger(t *testing.T) {
+	var lines []string
+	LogInfo = func(format string, p ...any) {
+		lines = append(lines, fmt.Sprintf(format, p...))
+	}
+	defer func() { LogInfo = nil }()
+
+	u := &Updater{conf: &Config{}}
+	u.logger().With("source", "test").WithGroup("update").Info("Update 100% applied", "bytes", 42, "latest", &Version{Number: "1.2.0"})
+	u.logger().Debug("not logged")
+
+	assert.Equal(t, []string{"Update 100% applied source=test update.bytes=42 update.latest.number=1.2.0\n"}, lines)
+}
@@ -0,0 +1,171 @@
+package selfupdate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Manifest describe a release as served by a ManifestSource
+type Manifest struct {
+	Version        string    `json:"version,omitempty"`         // Version number of the release
+	Build          int       `json:"build,omitempty"`           // Build number of the release
+	Date           time.Time `json:"date"`                      // Publication date of the release
+	Critical       bool      `json:"critical,omitempty"`        // Mark the release as a mandatory update
+	MinimumVersion string    `json:"minimum_version,omitempty"` // Oldest version number still supported, older one will be forced to update
+	MinimumBuild   int       `json:"minimum_build,omitempty"`   // Oldest build number still supported, older one will be forced to update
+	URL            string    `json:"url"`                       // Location of the executable, relative to the manifest, the signature is expected at ${URL}.ed25519
+	Size           int64     `json:"size,omitempty"`            // Size of the executable in bytes
+	ReleaseNotes   string    `json:"release_notes,omitempty"`   // Release notes in markdown
+}
+
+// ManifestSource provide a Source that will read the release information from a JSON
+// manifest served over HTTP and download the update from the URL it specify.
+type ManifestSource struct {
+	manifest *HTTPSource
+	opts     []HTTPSourceOption
+
+	lock   sync.Mutex
+	binary *HTTPSource
+}
+
+var _ Source = (*ManifestSource)(nil)
+var _ InstallRecorder = (*ManifestSource)(nil)
+
+// NewManifestSource provide a selfupdate.Source that will fetch the JSON manifest at the
+// specified URL using the http.Client provided. Both the manifest URL and the executable
+// URL it contains are Go Template string that recognize the same parameters as NewHTTPSource.
+// As an example, the following manifest:
+//
+//	{
+//	  "version": "1.2.0",
+//	  "date": "2022-06-22T10:00:00Z",
+//	  "minimum_version": "1.0.0",
+//	  "url": "myapp-{{.OS}}-{{.Arch}}{{.Ext}}"
+//	}
+//
+// would fetch on Linux AMD64 the executable `myapp-linux-amd64` next to the manifest and
+// force the update of any version older than 1.0.0. The options apply to the requests
+// for the manifest, the executable and its signature, WithValidatorCache only to the executable.
+func NewManifestSource(client *http.Client, manifestURL string, opts ...HTTPSourceOption) Source {
+	manifest := newHTTPSource(client, replaceURLTemplate(manifestURL), opts)
+	// the manifest is always fetched, the validators cached are the ones of the executable
+	manifest.cachePath = ""
+	return &ManifestSource{manifest: manifest, opts: opts}
+}
+
+// Get will return if it succeed an io.ReaderCloser to the new executable being downloaded and its length
+func (m *ManifestSource) Get(v *Version) (io.ReadCloser, int64, error) {
+	binary, err := m.binarySource()
+	if err != nil {
+		return nil, 0, err
+	}
+	return binary.Get(v)
+}
+
+// GetSignature will return the content of ${URL}.ed25519 where URL is the executable location
+func (m *ManifestSource) GetSignature() ([64]byte, error) {
+	binary, err := m.binarySource()
+	if err != nil {
+		return [64]byte{}, err
+	}
+	return binary.GetSignature()
+}
+
+// LatestVersion will fetch the manifest and return the release information it contains
+func (m *ManifestSource) LatestVersion() (*Version, error) {
+	manifest, err := m.fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest.Release(), nil
+}
+
+// RecordInstall remember the ETag and Last-Modified of the executable downloaded, so that it is
+// only downloaded again once it changed, and persist them if a validator cache is configured.
+func (m *ManifestSource) RecordInstall(*Version) error {
+	m.lock.Lock()
+	binary := m.binary
+	m.lock.Unlock()
+
+	if binary == nil {
+		return nil
+	}
+	return binary.recordDownload()
+}
+
+func (m *ManifestSource) binarySource() (*HTTPSource, error) {
+	m.lock.Lock()
+	binary := m.binary
+	m.lock.Unlock()
+
+	if binary != nil {
+		return binary, nil
+	}
+
+	if _, err := m.fetch(); err != nil {
+		return nil, err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.binary, nil
+}
+
+func (m *ManifestSource) fetch() (*Manifest, error) {
+	manifestURL := m.manifest.baseURL
+	resp, err := m.manifest.do("latest version", http.MethodGet, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	manifest := &Manifest{}
+	if err := json.NewDecoder(resp.Body).Decode(manifest); err != nil {
+		return nil, newSourceError("latest version", manifestURL, fmt.Errorf("%w: invalid manifest: %w", ErrNoVersion, err))
+	}
+	if manifest.URL == "" {
+		return nil, newSourceError("latest version", manifestURL, fmt.Errorf("%w: manifest does not specify an executable url", ErrNoVersion))
+	}
+
+	base, err := url.Parse(manifestURL)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := url.Parse(replaceURLTemplate(manifest.URL))
+	if err != nil {
+		return nil, err
+	}
+
+	binaryURL := base.ResolveReference(ref).String()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	// keep the validators of the executable while its location does not change
+	if m.binary == nil || m.binary.baseURL != binaryURL {
+		m.binary = newHTTPSource(m.manifest.client, binaryURL, m.opts)
+	}
+
+	return manifest, nil
+}
+
+// Release return the Version described by the manifest, for the Source reading a manifest
+// outside of this package
+func (manifest *Manifest) Release() *Version {
+	v := &Version{
+		Number:       manifest.Version,
+		Build:        manifest.Build,
+		Date:         manifest.Date,
+		Critical:     manifest.Critical,
+		Size:         manifest.Size,
+		ReleaseNotes: manifest.ReleaseNotes,
+	}
+	if manifest.MinimumVersion != "" || manifest.MinimumBuild != 0 {
+		v.Minimum = &Version{Number: manifest.MinimumVersion, Build: manifest.MinimumBuild}
+	}
+	return v
+}
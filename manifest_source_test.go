@@ -0,0 +1,122 @@
+package selfupdate
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifestSource(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/release/manifest.json", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{
+			"version": "1.2.0",
+			"date": "2022-06-22T10:00:00Z",
+			"critical": true,
+			"minimum_version": "1.0.0",
+			"url": "bin/myapp",
+			"size": 6,
+			"release_notes": "# 1.2.0\n\n- Fix crash on startup"
+		}`)
+	})
+	mux.HandleFunc("/release/bin/myapp", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(newFile)
+	})
+	mux.HandleFunc("/release/bin/myapp.ed25519", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 64))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	source := NewManifestSource(server.Client(), server.URL+"/release/manifest.json")
+
+	version, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.0", version.Number)
+	assert.Equal(t, time.Date(2022, 6, 22, 10, 0, 0, 0, time.UTC), version.Date)
+	assert.True(t, version.Critical)
+	assert.NotNil(t, version.Minimum)
+	assert.Equal(t, "1.0.0", version.Minimum.Number)
+	assert.Equal(t, int64(6), version.Size)
+	assert.Equal(t, "# 1.2.0\n\n- Fix crash on startup", version.ReleaseNotes)
+
+	signature, err := source.GetSignature()
+	assert.Nil(t, err)
+	assert.Equal(t, [64]byte{}, signature)
+
+	body, contentLength, err := source.Get(version)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(newFile)), contentLength)
+	content, err := io.ReadAll(body)
+	body.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, content)
+}
+
+func TestManifestSourceInvalid(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.json" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, `{"version": "1.2.0"}`)
+	}))
+	defer server.Close()
+
+	_, err := NewManifestSource(server.Client(), server.URL+"/missing.json").LatestVersion()
+	assert.NotNil(t, err)
+
+	_, err = NewManifestSource(server.Client(), server.URL+"/nourl.json").LatestVersion()
+	assert.NotNil(t, err)
+
+	_, _, err = NewManifestSource(server.Client(), server.URL+"/nourl.json").Get(nil)
+	assert.NotNil(t, err)
+}
+
+func TestManifestSourceRecordInstall(t *testing.T) {
+	var manifestConditional bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/manifest.json", func(w http.ResponseWriter, r *http.Request) {
+		manifestConditional = manifestConditional || r.Header.Get("If-None-Match") != ""
+		io.WriteString(w, `{"version": "1.2.0", "url": "myapp"}`)
+	})
+	mux.HandleFunc("/myapp", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1.2.0"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1.2.0"`)
+		w.Write(newFile)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	cache := filepath.Join(t.TempDir(), "validators.json")
+	source := NewManifestSource(server.Client(), server.URL+"/manifest.json", WithValidatorCache(cache))
+
+	version, err := source.LatestVersion()
+	assert.Nil(t, err)
+	body, _, err := source.Get(nil)
+	assert.Nil(t, err)
+	body.Close()
+	assert.Nil(t, source.(InstallRecorder).RecordInstall(version))
+
+	// the executable installed is not downloaded again, even after a restart
+	_, err = source.LatestVersion()
+	assert.Nil(t, err)
+	_, _, err = source.Get(nil)
+	assert.True(t, errors.Is(err, ErrNoUpdate))
+
+	source = NewManifestSource(server.Client(), server.URL+"/manifest.json", WithValidatorCache(cache))
+	_, err = source.LatestVersion()
+	assert.Nil(t, err)
+	_, _, err = source.Get(nil)
+	assert.True(t, errors.Is(err, ErrNoUpdate))
+	assert.False(t, manifestConditional)
+}
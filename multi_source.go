@@ -0,0 +1,327 @@
+package selfupdate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Mirror is one of the locations a MultiSource can fetch the update from
+type Mirror struct {
+	Name   string // Identify the mirror in errors and ServedBy
+	Source Source // The Source serving this mirror
+}
+
+// latencyGrace is how long WithLatencyOrder wait for the other mirrors once the fastest answered
+const latencyGrace = 100 * time.Millisecond
+
+// MultiSourceOption configure a MultiSource
+type MultiSourceOption func(*MultiSource)
+
+// WithLatencyOrder query all the mirrors for the latest version and prefer the fastest to
+// answer, instead of trying them in the priority order they are provided. The mirrors that
+// have not answered shortly after the fastest one are not waited for.
+func WithLatencyOrder() MultiSourceOption {
+	return func(m *MultiSource) {
+		m.byLatency = true
+	}
+}
+
+// MultiSource provide a Source that fall over between mirrors of the same update. The latest
+// version is read from the first mirror to answer, in priority or latency order, and another
+// mirror is only used for the signature and the download if it reports the same version and
+// signature. As the signature is verified end to end, a mirror does not need to be trusted.
+type MultiSource struct {
+	mirrors   []Mirror
+	byLatency bool
+	grace     time.Duration // how long the other mirrors are waited for once one answered
+
+	lock       sync.Mutex
+	latest     *Version
+	candidates []int        // mirrors to try in order, nil until the latest version is known
+	consistent map[int]bool // mirrors known to serve the latest version
+	reference  int          // mirror the latest version was read from
+	selected   int          // mirror that served the signature or the download, -1 if none
+	signature  *[64]byte
+	servedBy   string
+}
+
+var _ Source = (*MultiSource)(nil)
+var _ InstallRecorder = (*MultiSource)(nil)
+
+// NewMultiSource provide a selfupdate.Source that will fall over between the mirrors, they are
+// tried in the order provided unless WithLatencyOrder is specified.
+func NewMultiSource(mirrors []Mirror, opts ...MultiSourceOption) *MultiSource {
+	m := &MultiSource{mirrors: mirrors, grace: latencyGrace, reference: -1, selected: -1}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Get will return if it succeed an io.ReaderCloser to the new executable being downloaded and its length,
+// from the first mirror that serve the latest version and the same signature.
+func (m *MultiSource) Get(v *Version) (io.ReadCloser, int64, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var r io.ReadCloser
+	var contentLength int64
+	err := m.try(func(i int) error {
+		if m.signature != nil && i != m.selected {
+			s, err := m.mirrors[i].Source.GetSignature()
+			if err != nil {
+				return err
+			}
+			if s != *m.signature {
+				return fmt.Errorf("%w: different signature", ErrMirrorInconsistent)
+			}
+		}
+
+		var err error
+		r, contentLength, err = m.mirrors[i].Source.Get(v)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	m.servedBy = m.mirrors[m.selected].Name
+	return r, contentLength, nil
+}
+
+// GetSignature will return the signature of the latest version from the first mirror that serve it
+func (m *MultiSource) GetSignature() ([64]byte, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var signature [64]byte
+	err := m.try(func(i int) error {
+		s, err := m.mirrors[i].Source.GetSignature()
+		if err != nil {
+			return err
+		}
+		if m.signature != nil && s != *m.signature {
+			return fmt.Errorf("%w: different signature", ErrMirrorInconsistent)
+		}
+		signature = s
+		return nil
+	})
+	if err != nil {
+		return [64]byte{}, err
+	}
+
+	m.signature = &signature
+	return signature, nil
+}
+
+// LatestVersion will return the latest version reported by the first mirror to answer, if
+// all the mirrors fail the error of each of them are joined.
+func (m *MultiSource) LatestVersion() (*Version, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.latestVersion()
+}
+
+// ServedBy return the name of the mirror that served the last download, empty if none did
+func (m *MultiSource) ServedBy() string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.servedBy
+}
+
+// RecordInstall forwards to the mirror the installed version was read from if it implements InstallRecorder
+func (m *MultiSource) RecordInstall(v *Version) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.reference < 0 {
+		return nil
+	}
+	if recorder, ok := m.mirrors[m.reference].Source.(InstallRecorder); ok {
+		return recorder.RecordInstall(v)
+	}
+	return nil
+}
+
+func (m *MultiSource) latestVersion() (*Version, error) {
+	m.latest, m.candidates, m.consistent = nil, nil, map[int]bool{}
+	m.reference, m.selected, m.signature = -1, -1, nil
+
+	if m.byLatency {
+		return m.latestByLatency()
+	}
+	return m.latestByPriority()
+}
+
+func (m *MultiSource) latestByPriority() (*Version, error) {
+	var errs []error
+	for i, mirror := range m.mirrors {
+		v, err := mirror.Source.LatestVersion()
+		if err != nil && !errors.Is(err, ErrNoUpdate) {
+			errs = append(errs, m.mirrorError(i, err))
+			continue
+		}
+
+		m.latest, m.reference, m.consistent[i] = v, i, true
+		m.candidates = append([]int{i}, slices.Delete(m.order(), i, i+1)...)
+		return v, err
+	}
+	return nil, m.noMirror(errs)
+}
+
+// latestByLatency query all the mirrors concurrently, the fastest to answer give the latest
+// version and the mirrors reporting another version are left out. Once a mirror answered, the
+// others are only waited for during the grace period, the ones still silent are kept as
+// candidates that will be checked before being used.
+func (m *MultiSource) latestByLatency() (*Version, error) {
+	type answer struct {
+		i   int
+		v   *Version
+		err error
+	}
+
+	// buffered so that the mirrors answering after the grace period do not block forever
+	answers := make(chan answer, len(m.mirrors))
+	for i, mirror := range m.mirrors {
+		go func() {
+			v, err := mirror.Source.LatestVersion()
+			answers <- answer{i: i, v: v, err: err}
+		}()
+	}
+
+	answered := make([]bool, len(m.mirrors))
+	var errs []error
+	var failed []int
+	var grace <-chan time.Time
+	noUpdate := answer{i: -1}
+wait:
+	for range m.mirrors {
+		var a answer
+		select {
+		case a = <-answers:
+		case <-grace:
+			break wait
+		}
+		answered[a.i] = true
+
+		if a.err == nil {
+			if m.latest == nil {
+				m.latest, m.reference = a.v, a.i
+			}
+			if sameVersion(a.v, m.latest) {
+				m.consistent[a.i] = true
+				m.candidates = append(m.candidates, a.i)
+			}
+		} else {
+			errs = append(errs, m.mirrorError(a.i, a.err))
+			failed = append(failed, a.i)
+			if noUpdate.i < 0 && errors.Is(a.err, ErrNoUpdate) {
+				noUpdate = a
+			}
+		}
+		if grace == nil && (m.latest != nil || noUpdate.i >= 0) {
+			grace = time.After(m.grace)
+		}
+	}
+
+	// the mirrors that did not answer in time and the ones that failed to may still be able
+	// to serve the download
+	var unverified []int
+	for i := range m.mirrors {
+		if !answered[i] {
+			unverified = append(unverified, i)
+		}
+	}
+
+	if m.latest == nil {
+		if noUpdate.i >= 0 {
+			m.reference, m.candidates = noUpdate.i, append(unverified, failed...)
+			return nil, noUpdate.err
+		}
+		return nil, m.noMirror(errs)
+	}
+
+	m.candidates = append(append(m.candidates, unverified...), failed...)
+	return m.latest, nil
+}
+
+// try call fn for each mirror serving the latest version, starting by the one already selected,
+// until it succeed. A mirror reporting no update stops the search as it is not a failure.
+func (m *MultiSource) try(fn func(i int) error) error {
+	if m.candidates == nil {
+		if _, err := m.latestVersion(); err != nil && !errors.Is(err, ErrNoUpdate) {
+			return err
+		}
+	}
+
+	order := m.candidates
+	if m.selected >= 0 {
+		order = append([]int{m.selected}, slices.DeleteFunc(slices.Clone(order), func(i int) bool { return i == m.selected })...)
+	}
+
+	var errs []error
+	for _, i := range order {
+		if err := m.check(i); err != nil {
+			errs = append(errs, m.mirrorError(i, err))
+			continue
+		}
+
+		err := fn(i)
+		if err == nil {
+			m.selected = i
+			return nil
+		}
+		if errors.Is(err, ErrNoUpdate) {
+			return m.mirrorError(i, err)
+		}
+		errs = append(errs, m.mirrorError(i, err))
+	}
+	return m.noMirror(errs)
+}
+
+// check make sure the mirror serve the latest version, asking it if that is not known yet
+func (m *MultiSource) check(i int) error {
+	if m.latest == nil || m.consistent[i] {
+		return nil
+	}
+
+	v, err := m.mirrors[i].Source.LatestVersion()
+	if err != nil {
+		return err
+	}
+	if !sameVersion(v, m.latest) {
+		return fmt.Errorf("%w: different latest version", ErrMirrorInconsistent)
+	}
+	m.consistent[i] = true
+	return nil
+}
+
+func (m *MultiSource) order() []int {
+	order := make([]int, len(m.mirrors))
+	for i := range order {
+		order[i] = i
+	}
+	return order
+}
+
+func (m *MultiSource) mirrorError(i int, err error) error {
+	return fmt.Errorf("mirror %s: %w", m.mirrors[i].Name, err)
+}
+
+func (m *MultiSource) noMirror(errs []error) error {
+	if len(errs) == 0 {
+		return errors.New("no mirror available")
+	}
+	return errors.Join(errs...)
+}
+
+// sameVersion reports whether neither version is older than the other
+func sameVersion(a *Version, b *Version) bool {
+	return !a.Before(b) && !b.Before(a)
+}
@@ -0,0 +1,148 @@
+package selfupdate
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mirrorSource fails the download of a testSource or delays its answers
+type mirrorSource struct {
+	*testSource
+	getErr error
+	delay  time.Duration
+}
+
+func (s *mirrorSource) Get(v *Version) (io.ReadCloser, int64, error) {
+	if s.getErr != nil {
+		return nil, 0, s.getErr
+	}
+	return s.testSource.Get(v)
+}
+
+func (s *mirrorSource) LatestVersion() (*Version, error) {
+	time.Sleep(s.delay)
+	return s.testSource.LatestVersion()
+}
+
+func TestMultiSourceFailover(t *testing.T) {
+	source, publicKey := newSignedTestSource(t, "1.2.0")
+	down := errors.New("unreachable")
+	multi := NewMultiSource([]Mirror{
+		{Name: "s3", Source: &testSource{err: down}},
+		{Name: "onprem", Source: source},
+	})
+
+	var events []EventKind
+	updater := newTestUpdater(t, &Config{
+		Current:   &Version{Number: "1.0.0"},
+		Source:    multi,
+		PublicKey: publicKey,
+		Observer:  ObserverFunc(func(e Event) { events = append(events, e.Kind) }),
+	})
+
+	assert.Nil(t, updater.CheckNow())
+	assert.Contains(t, events, EventInstalled)
+	assert.Equal(t, "onprem", multi.ServedBy())
+}
+
+func TestMultiSourceInconsistent(t *testing.T) {
+	source, _ := newSignedTestSource(t, "1.2.0")
+	other, _ := newSignedTestSource(t, "1.2.0")
+	stale, _ := newSignedTestSource(t, "1.1.0")
+	stale.signature = source.signature
+
+	down := errors.New("unreachable")
+	multi := NewMultiSource([]Mirror{
+		{Name: "primary", Source: &mirrorSource{testSource: source, getErr: down}},
+		{Name: "other-key", Source: other},
+		{Name: "stale", Source: stale},
+	})
+
+	latest, err := multi.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.0", latest.Number)
+
+	signature, err := multi.GetSignature()
+	assert.Nil(t, err)
+	assert.Equal(t, source.signature, signature)
+
+	_, _, err = multi.Get(nil)
+	assert.True(t, errors.Is(err, down))
+	assert.True(t, errors.Is(err, ErrMirrorInconsistent))
+	assert.Contains(t, err.Error(), "mirror other-key: inconsistent mirror: different signature")
+	assert.Contains(t, err.Error(), "mirror stale: inconsistent mirror: different latest version")
+	assert.Equal(t, "", multi.ServedBy())
+
+	// a consistent mirror takes over
+	multi.mirrors[2].Source = &testSource{version: &Version{Number: "1.2.0"}, content: newFile, signature: source.signature}
+	r, _, err := multi.Get(nil)
+	assert.Nil(t, err)
+	r.Close()
+	assert.Equal(t, "stale", multi.ServedBy())
+}
+
+func TestMultiSourceLatency(t *testing.T) {
+	slow, _ := newSignedTestSource(t, "1.1.0")
+	fast, _ := newSignedTestSource(t, "1.2.0")
+	multi := NewMultiSource([]Mirror{
+		{Name: "slow", Source: &mirrorSource{testSource: slow, delay: 50 * time.Millisecond}},
+		{Name: "fast", Source: fast},
+		{Name: "down", Source: &testSource{err: errors.New("unreachable")}},
+	}, WithLatencyOrder())
+	multi.grace = time.Second
+
+	latest, err := multi.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.0", latest.Number)
+	assert.Equal(t, []int{1, 2}, multi.candidates)
+
+	signature, err := multi.GetSignature()
+	assert.Nil(t, err)
+	assert.Equal(t, fast.signature, signature)
+
+	r, _, err := multi.Get(nil)
+	assert.Nil(t, err)
+	r.Close()
+	assert.Equal(t, "fast", multi.ServedBy())
+
+	multi = NewMultiSource([]Mirror{{Name: "down", Source: &testSource{err: errors.New("unreachable")}}}, WithLatencyOrder())
+	_, err = multi.LatestVersion()
+	assert.EqualError(t, err, "mirror down: unreachable")
+}
+
+func TestMultiSourceLatencyHung(t *testing.T) {
+	hung, _ := newSignedTestSource(t, "1.2.0")
+	fast, _ := newSignedTestSource(t, "1.2.0")
+	down := &testSource{err: errors.New("unreachable")}
+	multi := NewMultiSource([]Mirror{
+		{Name: "hung", Source: &mirrorSource{testSource: hung, delay: time.Hour}},
+		{Name: "down", Source: down},
+		{Name: "fast", Source: fast},
+	}, WithLatencyOrder())
+	multi.grace = 10 * time.Millisecond
+
+	start := time.Now()
+	latest, err := multi.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.0", latest.Number)
+	assert.Less(t, time.Since(start), time.Minute)
+	assert.Equal(t, []int{2, 0, 1}, multi.candidates)
+	assert.False(t, multi.consistent[0])
+
+	r, _, err := multi.Get(nil)
+	assert.Nil(t, err)
+	r.Close()
+	assert.Equal(t, "fast", multi.ServedBy())
+
+	// a mirror reporting no update answered too
+	multi = NewMultiSource([]Mirror{
+		{Name: "down", Source: down},
+		{Name: "noupdate", Source: &testSource{err: ErrNoUpdate}},
+	}, WithLatencyOrder())
+	_, err = multi.LatestVersion()
+	assert.True(t, errors.Is(err, ErrNoUpdate))
+}
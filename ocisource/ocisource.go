@@ -0,0 +1,367 @@
+// Package ocisource provide a selfupdate.Source that will pull the update from an OCI registry,
+// where it has been pushed as an artifact, for example with ORAS. It lives in its own package so
+// that applications that do not use a registry do not depend on the OCI libraries.
+//
+//	config := &selfupdate.Config{
+//		Source: ocisource.New(nil, "registry.example.com/myapp:latest", "myapp-{{.OS}}-{{.Arch}}{{.Ext}}"),
+//		...
+//	}
+package ocisource
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/solodyagin/selfupdate"
+)
+
+// Media types of the manifests a Source can resolve
+const (
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+// maxManifestSize protect against a registry serving an unreasonably large manifest
+const maxManifestSize = 4 << 20
+
+// Source provide a selfupdate.Source that will pull the update from an OCI registry, where it has been
+// pushed as an artifact, for example with ORAS. The executable and its signature are layers of
+// the artifact manifest, identified by their org.opencontainers.image.title annotation, and
+// are downloaded by digest.
+type Source struct {
+	http       *selfupdate.HTTPSource
+	scheme     string
+	registry   string
+	repository string
+	reference  string
+	layer      string
+	err        error
+
+	lock      sync.Mutex
+	binary    *v1.Descriptor
+	signature *v1.Descriptor
+}
+
+var _ selfupdate.Source = (*Source)(nil)
+
+// New provide a selfupdate.Source that will resolve the reference, in the form
+// `registry/repository:tag` or `registry/repository@sha256:...`, to an artifact manifest or
+// to the manifest of the running platform when it is an image index. The registry is reached
+// over HTTPS unless the reference is prefixed by http://, and authentication is left to the
+// http.Client provided.
+// The layer is the title of the executable, a Go Template string that recognize the same
+// parameters as selfupdate.NewHTTPSource, its signature being expected in the layer titled ${layer}.ed25519.
+// If the layer is empty, the artifact must contain a single executable and a single signature.
+// As an example, an artifact pushed with:
+//
+//	oras push registry.example.com/myapp:latest myapp-linux-amd64 myapp-linux-amd64.ed25519
+//
+// would be pulled on Linux AMD64 by:
+//
+//	ocisource.New(nil, "registry.example.com/myapp:latest", "myapp-{{.OS}}-{{.Arch}}{{.Ext}}")
+func New(client *http.Client, reference string, layer string, opts ...selfupdate.HTTPSourceOption) selfupdate.Source {
+	o := &Source{
+		http:   selfupdate.NewHTTPSource(client, "", opts...).(*selfupdate.HTTPSource),
+		scheme: "https",
+		layer:  selfupdate.ExpandTemplate(layer),
+	}
+
+	if scheme, rest, ok := strings.Cut(reference, "://"); ok {
+		o.scheme, reference = scheme, rest
+	}
+	var err error
+	o.registry, o.repository, o.reference, err = parseReference(reference)
+	o.err = selfupdate.NewSourceError("resolve", reference, err)
+	return o
+}
+
+// Get will return if it succeed an io.ReaderCloser to the executable layer being downloaded and its size.
+// The digest of the layer is checked once it has been fully read.
+func (o *Source) Get(v *selfupdate.Version) (io.ReadCloser, int64, error) {
+	binary, _, err := o.layers()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	r, err := o.blob("get", binary)
+	if err != nil {
+		return nil, 0, err
+	}
+	return r, binary.Size, nil
+}
+
+// GetSignature will return the content of the signature layer
+func (o *Source) GetSignature() ([64]byte, error) {
+	_, signature, err := o.layers()
+	if err != nil {
+		return [64]byte{}, err
+	}
+
+	r, err := o.blob("get signature", signature)
+	if err != nil {
+		return [64]byte{}, err
+	}
+	defer r.Close()
+
+	s, err := selfupdate.ReadSignature(r, signature.Size)
+	if err != nil {
+		return [64]byte{}, selfupdate.NewSourceError("get signature", o.blobURL(signature.Digest), err)
+	}
+	// read to the end for the digest to be checked
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return [64]byte{}, selfupdate.NewSourceError("get signature", o.blobURL(signature.Digest), err)
+	}
+	return s, nil
+}
+
+// LatestVersion will resolve the reference and return the version of the artifact, from its
+// org.opencontainers.image.version and org.opencontainers.image.created annotations, and the
+// size of the executable layer
+func (o *Source) LatestVersion() (*selfupdate.Version, error) {
+	manifest, binary, err := o.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	v := &selfupdate.Version{
+		Number:       manifest.Annotations[v1.AnnotationVersion],
+		ReleaseNotes: manifest.Annotations[v1.AnnotationDescription],
+		Size:         binary.Size,
+	}
+	if created := manifest.Annotations[v1.AnnotationCreated]; created != "" {
+		if v.Date, err = time.Parse(time.RFC3339, created); err != nil {
+			return nil, selfupdate.NewSourceError("latest version", o.manifestURL(o.reference), fmt.Errorf("%w: %w", selfupdate.ErrNoVersion, err))
+		}
+	}
+	if v.Number == "" && v.Date.IsZero() {
+		return nil, selfupdate.NewSourceError("latest version", o.manifestURL(o.reference), fmt.Errorf("%w: no version or creation annotation", selfupdate.ErrNoVersion))
+	}
+	return v, nil
+}
+
+// ociManifest covers both an image manifest and an image index
+type ociManifest struct {
+	MediaType   string            `json:"mediaType"`
+	Manifests   []v1.Descriptor   `json:"manifests"`
+	Layers      []v1.Descriptor   `json:"layers"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+func (o *Source) layers() (*v1.Descriptor, *v1.Descriptor, error) {
+	o.lock.Lock()
+	binary, signature := o.binary, o.signature
+	o.lock.Unlock()
+
+	if binary != nil {
+		return binary, signature, nil
+	}
+
+	if _, _, err := o.resolve(); err != nil {
+		return nil, nil, err
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.binary, o.signature, nil
+}
+
+// resolve fetch the manifest of the reference, following the image index to the running platform,
+// and pick the executable and signature layers
+func (o *Source) resolve() (*ociManifest, *v1.Descriptor, error) {
+	if o.err != nil {
+		return nil, nil, o.err
+	}
+
+	// a reference pinned to a digest is checked like the manifests of an index
+	var pinned digest.Digest
+	if d := digest.Digest(o.reference); d.Validate() == nil {
+		pinned = d
+	}
+	manifest, err := o.manifest(o.reference, pinned)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if manifest.MediaType == v1.MediaTypeImageIndex || manifest.MediaType == mediaTypeDockerManifestList || len(manifest.Manifests) > 0 {
+		platform, err := o.platformManifest(manifest)
+		if err != nil {
+			return nil, nil, err
+		}
+		if manifest, err = o.manifest(platform.Digest.String(), platform.Digest); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	binary, signature, err := o.pickLayers(manifest.Layers)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.binary, o.signature = binary, signature
+	return manifest, binary, nil
+}
+
+func (o *Source) platformManifest(index *ociManifest) (*v1.Descriptor, error) {
+	for i, m := range index.Manifests {
+		if m.Platform != nil && m.Platform.OS == runtime.GOOS && m.Platform.Architecture == runtime.GOARCH {
+			return &index.Manifests[i], nil
+		}
+	}
+	return nil, selfupdate.NewSourceError("latest version", o.manifestURL(o.reference),
+		fmt.Errorf("%w: no manifest for %s/%s in the index", selfupdate.ErrNoVersion, runtime.GOOS, runtime.GOARCH))
+}
+
+func (o *Source) pickLayers(layers []v1.Descriptor) (*v1.Descriptor, *v1.Descriptor, error) {
+	var binary, signature *v1.Descriptor
+	for i, l := range layers {
+		title := l.Annotations[v1.AnnotationTitle]
+		switch {
+		case o.layer != "" && title == o.layer:
+			binary = &layers[i]
+		case o.layer != "" && title == o.layer+".ed25519":
+			signature = &layers[i]
+		case o.layer != "":
+			// another platform or file of the artifact
+		case strings.HasSuffix(title, ".ed25519"):
+			if signature != nil {
+				return nil, nil, o.layerError("more than one signature layer")
+			}
+			signature = &layers[i]
+		default:
+			if binary != nil {
+				return nil, nil, o.layerError("more than one executable layer")
+			}
+			binary = &layers[i]
+		}
+	}
+
+	if binary == nil {
+		return nil, nil, o.layerError("no executable layer")
+	}
+	if signature == nil {
+		return nil, nil, o.layerError("no signature layer")
+	}
+	return binary, signature, nil
+}
+
+func (o *Source) layerError(msg string) error {
+	if o.layer != "" {
+		msg += " titled " + o.layer
+	}
+	return selfupdate.NewSourceError("latest version", o.manifestURL(o.reference), fmt.Errorf("%w: %s", selfupdate.ErrNoVersion, msg))
+}
+
+// manifest fetch a manifest by tag or digest, the content is checked against the expected digest if any
+func (o *Source) manifest(reference string, expected digest.Digest) (*ociManifest, error) {
+	header := http.Header{}
+	header.Set("Accept", strings.Join([]string{v1.MediaTypeImageManifest, v1.MediaTypeImageIndex,
+		mediaTypeDockerManifest, mediaTypeDockerManifestList}, ", "))
+
+	u := o.manifestURL(reference)
+	resp, err := o.http.Do("latest version", http.MethodGet, u, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+	if err != nil {
+		return nil, selfupdate.NewSourceError("latest version", u, err)
+	}
+	if expected != "" {
+		if err := expected.Validate(); err != nil {
+			return nil, selfupdate.NewSourceError("latest version", u, fmt.Errorf("%w: %w", selfupdate.ErrNoVersion, err))
+		}
+		if expected.Algorithm().FromBytes(content) != expected {
+			return nil, selfupdate.NewSourceError("latest version", u, fmt.Errorf("%w: manifest digest", selfupdate.ErrChecksumMismatch))
+		}
+	}
+
+	manifest := &ociManifest{}
+	if err := json.Unmarshal(content, manifest); err != nil {
+		return nil, selfupdate.NewSourceError("latest version", u, fmt.Errorf("%w: invalid manifest: %w", selfupdate.ErrNoVersion, err))
+	}
+	if manifest.MediaType == "" {
+		manifest.MediaType = resp.Header.Get("Content-Type")
+	}
+	return manifest, nil
+}
+
+// blob start downloading a blob, its digest is checked when the end of the content is read
+func (o *Source) blob(op string, d *v1.Descriptor) (io.ReadCloser, error) {
+	if err := d.Digest.Validate(); err != nil {
+		return nil, selfupdate.NewSourceError(op, o.blobURL(d.Digest), fmt.Errorf("%w: %w", selfupdate.ErrNoVersion, err))
+	}
+
+	u := o.blobURL(d.Digest)
+	resp, err := o.http.Do(op, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &digestReader{ReadCloser: resp.Body, expected: d.Digest, verifier: d.Digest.Verifier(), size: d.Size}, nil
+}
+
+func (o *Source) manifestURL(reference string) string {
+	return fmt.Sprintf("%s://%s/v2/%s/manifests/%s", o.scheme, o.registry, o.repository, reference)
+}
+
+func (o *Source) blobURL(d digest.Digest) string {
+	return fmt.Sprintf("%s://%s/v2/%s/blobs/%s", o.scheme, o.registry, o.repository, d)
+}
+
+// digestReader check the size and digest of a blob when the end of its content is reached
+type digestReader struct {
+	io.ReadCloser
+	expected digest.Digest
+	verifier digest.Verifier
+	size     int64
+	read     int64
+}
+
+func (r *digestReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.read += int64(n)
+	r.verifier.Write(p[:n])
+
+	switch {
+	case r.size > 0 && r.read > r.size:
+		return n, fmt.Errorf("%w: blob %s is larger than %d bytes", selfupdate.ErrChecksumMismatch, r.expected, r.size)
+	case errors.Is(err, io.EOF) && !r.verifier.Verified():
+		return n, fmt.Errorf("%w: blob digest is not %s", selfupdate.ErrChecksumMismatch, r.expected)
+	}
+	return n, err
+}
+
+// parseReference split a reference like registry/repository:tag or registry/repository@digest
+func parseReference(reference string) (registry string, repository string, tagOrDigest string, err error) {
+	registry, repository, ok := strings.Cut(reference, "/")
+	if !ok || registry == "" || repository == "" {
+		return "", "", "", fmt.Errorf("invalid OCI reference %q: expecting registry/repository:tag", reference)
+	}
+
+	tagOrDigest = "latest"
+	if i := strings.Index(repository, "@"); i >= 0 {
+		repository, tagOrDigest = repository[:i], repository[i+1:]
+		if err := digest.Digest(tagOrDigest).Validate(); err != nil {
+			return "", "", "", fmt.Errorf("invalid OCI reference %q: %w", reference, err)
+		}
+	} else if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		repository, tagOrDigest = repository[:i], repository[i+1:]
+	}
+
+	if repository == "" || tagOrDigest == "" {
+		return "", "", "", fmt.Errorf("invalid OCI reference %q", reference)
+	}
+	return registry, repository, tagOrDigest, nil
+}
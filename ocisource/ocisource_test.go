@@ -0,0 +1,240 @@
+package ocisource
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/solodyagin/selfupdate"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	oldFile = []byte{0xDE, 0xAD, 0xBE, 0xEF}
+	newFile = []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+)
+
+func newTestRegistry() *httptest.Server {
+	return httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+}
+
+// pushBlob upload a blob to the in-process registry the way ORAS does, in a single request
+func pushBlob(t *testing.T, server *httptest.Server, repository string, content []byte, title string) v1.Descriptor {
+	d := v1.Descriptor{MediaType: "application/octet-stream", Digest: digest.FromBytes(content), Size: int64(len(content))}
+	if title != "" {
+		d.Annotations = map[string]string{v1.AnnotationTitle: title}
+	}
+
+	resp, err := http.Post(server.URL+"/v2/"+repository+"/blobs/uploads/", "", nil)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	location := resp.Header.Get("Location")
+	if strings.HasPrefix(location, "/") {
+		location = server.URL + location
+	}
+
+	req, _ := http.NewRequest(http.MethodPut, location+"?digest="+d.Digest.String(), bytes.NewReader(content))
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	return d
+}
+
+func pushManifest(t *testing.T, server *httptest.Server, repository string, reference string, manifest any, mediaType string) v1.Descriptor {
+	content, err := json.Marshal(manifest)
+	assert.Nil(t, err)
+
+	d := v1.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(content), Size: int64(len(content))}
+	if reference == "" {
+		reference = d.Digest.String()
+	}
+
+	req, _ := http.NewRequest(http.MethodPut, server.URL+"/v2/"+repository+"/manifests/"+reference, bytes.NewReader(content))
+	req.Header.Set("Content-Type", mediaType)
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	return d
+}
+
+func pushArtifact(t *testing.T, server *httptest.Server, repository string, reference string, annotations map[string]string, layers ...v1.Descriptor) v1.Descriptor {
+	config := pushBlob(t, server, repository, []byte("{}"), "")
+	config.MediaType = v1.MediaTypeEmptyJSON
+	return pushManifest(t, server, repository, reference, v1.Manifest{
+		Versioned:    specs.Versioned{SchemaVersion: 2},
+		MediaType:    v1.MediaTypeImageManifest,
+		ArtifactType: "application/vnd.example.app",
+		Config:       config,
+		Layers:       layers,
+		Annotations:  annotations,
+	}, v1.MediaTypeImageManifest)
+}
+
+func TestSource(t *testing.T) {
+	server := newTestRegistry()
+	defer server.Close()
+
+	signature := bytes.Repeat([]byte{42}, 64)
+	pushArtifact(t, server, "team/app", "1.2.0", map[string]string{
+		v1.AnnotationVersion: "1.2.0",
+		v1.AnnotationCreated: "2022-06-22T10:00:00Z",
+	},
+		pushBlob(t, server, "team/app", newFile, "app-"+runtime.GOOS),
+		pushBlob(t, server, "team/app", signature, "app-"+runtime.GOOS+".ed25519"),
+		pushBlob(t, server, "team/app", []byte("other"), "app-plan9"))
+
+	source := New(nil, server.URL+"/team/app:1.2.0", "app-{{.OS}}")
+	version, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.0", version.Number)
+	assert.Equal(t, "2022-06-22T10:00:00Z", version.Date.Format("2006-01-02T15:04:05Z07:00"))
+	assert.Equal(t, int64(len(newFile)), version.Size)
+
+	s, err := source.GetSignature()
+	assert.Nil(t, err)
+	assert.Equal(t, signature, s[:])
+
+	r, size, err := source.Get(version)
+	assert.Nil(t, err)
+	content, err := io.ReadAll(r)
+	r.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, content)
+	assert.Equal(t, int64(len(newFile)), size)
+
+	_, err = New(nil, server.URL+"/team/app:1.2.0", "").LatestVersion()
+	assert.True(t, errors.Is(err, selfupdate.ErrNoVersion))
+	assert.Contains(t, err.Error(), "more than one executable layer")
+
+	_, err = New(nil, "app:1.2.0", "").LatestVersion()
+	var se *selfupdate.SourceError
+	assert.True(t, errors.As(err, &se))
+}
+
+func TestSourceIndex(t *testing.T) {
+	server := newTestRegistry()
+	defer server.Close()
+
+	platform := pushArtifact(t, server, "app", "", map[string]string{v1.AnnotationCreated: "2022-06-22T10:00:00Z"},
+		pushBlob(t, server, "app", newFile, "app"),
+		pushBlob(t, server, "app", make([]byte, 64), "app.ed25519"))
+	platform.Platform = &v1.Platform{OS: runtime.GOOS, Architecture: runtime.GOARCH}
+	pushManifest(t, server, "app", "latest", v1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: v1.MediaTypeImageIndex,
+		Manifests: []v1.Descriptor{platform},
+	}, v1.MediaTypeImageIndex)
+
+	source := New(server.Client(), server.URL+"/app", "")
+	version, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(newFile)), version.Size)
+	assert.False(t, version.Date.IsZero())
+
+	r, _, err := source.Get(version)
+	assert.Nil(t, err)
+	content, err := io.ReadAll(r)
+	r.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, content)
+}
+
+func TestSourceDigestMismatch(t *testing.T) {
+	handler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	var tampered string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a registry or a proxy serving a tampered blob
+		if tampered != "" && strings.HasSuffix(r.URL.Path, tampered) {
+			w.Write(oldFile)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	binary := pushBlob(t, server, "app", newFile, "app")
+	pushArtifact(t, server, "app", "latest", map[string]string{v1.AnnotationVersion: "1.2.0"},
+		binary, pushBlob(t, server, "app", make([]byte, 64), "app.ed25519"))
+	tampered = binary.Digest.String()
+
+	source := New(nil, server.URL+"/app", "app")
+	r, _, err := source.Get(nil)
+	assert.Nil(t, err)
+	_, err = io.ReadAll(r)
+	r.Close()
+	assert.True(t, errors.Is(err, selfupdate.ErrChecksumMismatch))
+
+	signature, err := source.GetSignature()
+	assert.Nil(t, err)
+	assert.Equal(t, [64]byte{}, signature)
+}
+
+func TestSourcePinnedDigest(t *testing.T) {
+	handler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	var pinned string
+	var tampered []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a registry or a proxy serving another manifest for the digest
+		if tampered != nil && strings.HasSuffix(r.URL.Path, "/manifests/"+pinned) {
+			w.Header().Set("Content-Type", v1.MediaTypeImageManifest)
+			w.Write(tampered)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	release := pushArtifact(t, server, "app", "", map[string]string{v1.AnnotationVersion: "1.2.0"},
+		pushBlob(t, server, "app", newFile, "app"), pushBlob(t, server, "app", make([]byte, 64), "app.ed25519"))
+	pinned = release.Digest.String()
+
+	version, err := New(nil, server.URL+"/app@"+pinned, "app").LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.0", version.Number)
+
+	other := pushArtifact(t, server, "app", "other", map[string]string{v1.AnnotationVersion: "6.6.6"},
+		pushBlob(t, server, "app", oldFile, "app"), pushBlob(t, server, "app", make([]byte, 64), "app.ed25519"))
+	resp, err := http.Get(server.URL + "/v2/app/manifests/" + other.Digest.String())
+	assert.Nil(t, err)
+	tampered, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Nil(t, err)
+
+	_, err = New(nil, server.URL+"/app@"+pinned, "app").LatestVersion()
+	assert.True(t, errors.Is(err, selfupdate.ErrChecksumMismatch))
+	_, _, err = New(nil, server.URL+"/app@"+pinned, "app").Get(nil)
+	assert.True(t, errors.Is(err, selfupdate.ErrChecksumMismatch))
+}
+
+func TestParseReference(t *testing.T) {
+	registry, repository, reference, err := parseReference("localhost:5000/team/app")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"localhost:5000", "team/app", "latest"}, []string{registry, repository, reference})
+
+	_, repository, reference, err = parseReference("registry.example.com/app:1.2.0")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"app", "1.2.0"}, []string{repository, reference})
+
+	d := digest.FromBytes(newFile).String()
+	_, repository, reference, err = parseReference("registry.example.com/app@" + d)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"app", d}, []string{repository, reference})
+
+	_, _, _, err = parseReference("registry.example.com/app@sha256:nope")
+	assert.NotNil(t, err)
+	_, _, _, err = parseReference("app")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,90 @@
+package selfupdate
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/solodyagin/selfupdate/internal/osext"
+)
+
+// ApplyOnExit install the update staged by Stage, or downloaded after the user chose
+// ActionInstallOnExit, while the application shuts down. The staged update is already verified,
+// so the swap is quick and does not need the network. It does nothing if no update is staged and
+// return ErrUpdateInProgress, rather than waiting, if a check or an install is running.
+//
+// The application is not restarted as it is exiting: RestartConfirmCallback, if present, is asked
+// whether to start the new version right away, otherwise it runs on the next start.
+func (u *Updater) ApplyOnExit() error {
+	if !u.lock.TryLock() {
+		return ErrUpdateInProgress
+	}
+	defer u.lock.Unlock()
+
+	log := u.logger()
+
+	staged, err := u.installStaged(log)
+	if err != nil || staged == nil {
+		return err
+	}
+
+	if ask := u.conf.RestartConfirmCallback; ask == nil || !ask() {
+		log.Info("The update will run on the next start of the application", "latest", staged)
+		u.emit(EventRestartPending, staged, nil)
+		return nil
+	}
+
+	executable := u.executable
+	if executable == "" {
+		if executable, err = osext.Executable(); err != nil {
+			return err
+		}
+	}
+	log.Info("Starting the new version", "latest", staged)
+	return startProcess(executable)
+}
+
+// ApplyOnExitSignals call ApplyOnExit when the application receive one of the signals, os.Interrupt
+// and SIGTERM if none is given, and then exit through ExitCallback with the error of ApplyOnExit if
+// present, or with os.Exit otherwise. The returned function stop handling the signals.
+func (u *Updater) ApplyOnExitSignals(signals ...os.Signal) (stop func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(c, signals...)
+
+	go func() {
+		select {
+		case <-done:
+			return
+		case sig := <-c:
+			signal.Stop(c)
+			u.logger().Info("Exiting on signal", "signal", sig)
+
+			err := u.ApplyOnExit()
+			if err != nil {
+				u.logger().Error("Unable to apply the update on exit", "error", err)
+			}
+			if u.conf.ExitCallback != nil {
+				u.conf.ExitCallback(err)
+				return
+			}
+			if err != nil {
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(c)
+			close(done)
+		})
+	}
+}
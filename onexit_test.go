@@ -0,0 +1,55 @@
+package selfupdate
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyOnExit(t *testing.T) {
+	decision := UpgradeDecision{Action: ActionInstallOnExit}
+	asked := 0
+	updater, source := newDecisionUpdater(t, &decision, &asked)
+
+	// nothing staged
+	assert.Nil(t, updater.ApplyOnExit())
+
+	assert.Nil(t, updater.CheckNow())
+	assert.Equal(t, "1.2.0", updater.Pending().Number)
+
+	var kinds []EventKind
+	updater.AddObserver(ObserverFunc(func(e Event) { kinds = append(kinds, e.Kind) }))
+	// the swap does not need the network
+	updater.conf.Source = &mirrorSource{testSource: source, getErr: errors.New("unreachable")}
+	assert.Nil(t, updater.ApplyOnExit())
+	assert.Equal(t, []EventKind{EventInstalled, EventRestartPending}, kinds)
+	assert.Nil(t, updater.Pending())
+	assert.Equal(t, StateRestartPending, updater.Status().State)
+	assert.Equal(t, "", updater.store().get().OnExit)
+
+	content, err := os.ReadFile(updater.target)
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, content)
+}
+
+func TestApplyOnExitInProgress(t *testing.T) {
+	source, publicKey := newSignedTestSource(t, "1.1.0")
+	u := newTestUpdater(t, &Config{Current: &Version{Number: "1.0.0"}, Source: source, PublicKey: publicKey})
+	assert.Nil(t, u.Stage())
+
+	u.lock.Lock()
+	assert.True(t, errors.Is(u.ApplyOnExit(), ErrUpdateInProgress))
+	u.lock.Unlock()
+	assert.Equal(t, "1.1.0", u.Pending().Number)
+
+	// an altered staged executable is not installed
+	binary, _ := stagedPaths(u.target)
+	assert.Nil(t, os.WriteFile(binary, []byte("tampered"), 0600))
+	assert.True(t, errors.Is(u.ApplyOnExit(), ErrChecksumMismatch))
+
+	content, err := os.ReadFile(u.target)
+	assert.Nil(t, err)
+	assert.Equal(t, oldFile, content)
+}
@@ -0,0 +1,347 @@
+// Package otelselfupdate records OpenTelemetry spans and metrics for the update process of a
+// selfupdate.Updater. It lives in its own package so that applications that do not use
+// OpenTelemetry do not depend on it.
+//
+//	instrumentation, err := otelselfupdate.New()
+//	if err != nil {
+//		return err
+//	}
+//	config := &selfupdate.Config{
+//		Source:   instrumentation.Source(selfupdate.NewHTTPSource(nil, url)),
+//		Observer: instrumentation,
+//		...
+//	}
+//
+// An Instrumentation follows the checks of a single Updater.
+package otelselfupdate
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/solodyagin/selfupdate"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope used for the tracer and the meter
+const ScopeName = "github.com/solodyagin/selfupdate/otelselfupdate"
+
+// Attribute keys recorded on spans and metrics
+const (
+	VersionKey       = attribute.Key("selfupdate.version")        // The version running or being installed
+	LatestVersionKey = attribute.Key("selfupdate.latest_version") // The latest version available
+	ResultKey        = attribute.Key("selfupdate.result")         // The outcome of a check
+	FailureKey       = attribute.Key("selfupdate.failure")        // The stage that failed
+	BytesKey         = attribute.Key("selfupdate.bytes")          // The bytes downloaded
+)
+
+// Option configure an Instrumentation
+type Option func(*config)
+
+type config struct {
+	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
+}
+
+// WithTracerProvider specify the TracerProvider to use instead of the global one
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = tp
+	}
+}
+
+// WithMeterProvider specify the MeterProvider to use instead of the global one
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(c *config) {
+		c.meterProvider = mp
+	}
+}
+
+// Instrumentation is a selfupdate.Observer that turn the update events into spans and metrics
+type Instrumentation struct {
+	tracer trace.Tracer
+
+	checks           metric.Int64Counter
+	failures         metric.Int64Counter
+	installs         metric.Int64Counter
+	bytes            metric.Int64Counter
+	downloadDuration metric.Float64Histogram
+
+	lock    sync.Mutex
+	version string
+	ctx     context.Context
+	check   trace.Span
+	stage   trace.Span
+}
+
+var _ selfupdate.Observer = (*Instrumentation)(nil)
+
+// New create an Instrumentation using the global providers unless specified otherwise
+func New(opts ...Option) (*Instrumentation, error) {
+	c := &config{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.tracerProvider == nil {
+		c.tracerProvider = otel.GetTracerProvider()
+	}
+	if c.meterProvider == nil {
+		c.meterProvider = otel.GetMeterProvider()
+	}
+
+	meter := c.meterProvider.Meter(ScopeName)
+	i := &Instrumentation{tracer: c.tracerProvider.Tracer(ScopeName), ctx: context.Background()}
+
+	var err error
+	if i.checks, err = meter.Int64Counter("selfupdate.checks",
+		metric.WithDescription("Number of update checks by result")); err != nil {
+		return nil, err
+	}
+	if i.failures, err = meter.Int64Counter("selfupdate.failures",
+		metric.WithDescription("Number of failed update by stage")); err != nil {
+		return nil, err
+	}
+	if i.installs, err = meter.Int64Counter("selfupdate.installs",
+		metric.WithDescription("Number of update installed by version")); err != nil {
+		return nil, err
+	}
+	if i.bytes, err = meter.Int64Counter("selfupdate.download.bytes",
+		metric.WithDescription("Bytes downloaded by the sources"), metric.WithUnit("By")); err != nil {
+		return nil, err
+	}
+	if i.downloadDuration, err = meter.Float64Histogram("selfupdate.download.duration",
+		metric.WithDescription("Duration of the update downloads"), metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	if _, err = meter.Int64ObservableGauge("selfupdate.running",
+		metric.WithDescription("Always 1, the running version is recorded as attribute"),
+		metric.WithInt64Callback(i.observeVersion)); err != nil {
+		return nil, err
+	}
+
+	return i, nil
+}
+
+func (i *Instrumentation) observeVersion(_ context.Context, o metric.Int64Observer) error {
+	i.lock.Lock()
+	version := i.version
+	i.lock.Unlock()
+
+	if version != "" {
+		o.Observe(1, metric.WithAttributes(VersionKey.String(version)))
+	}
+	return nil
+}
+
+// OnEvent implements selfupdate.Observer
+func (i *Instrumentation) OnEvent(e selfupdate.Event) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	switch e.Kind {
+	case selfupdate.EventCheckStarted:
+		i.endCheck(e, nil)
+		i.version = versionString(e.Version)
+		i.ctx, i.check = i.tracer.Start(context.Background(), "selfupdate.check",
+			trace.WithTimestamp(e.Time), trace.WithAttributes(VersionKey.String(i.version)))
+	case selfupdate.EventNoUpdate:
+		i.checked(e)
+		i.endCheck(e, nil)
+	case selfupdate.EventUpdateDeclined:
+		i.endCheck(e, nil)
+	case selfupdate.EventCheckFailed:
+		i.checked(e)
+		i.fail(e)
+	case selfupdate.EventUpdateFound:
+		i.checked(e)
+		if i.check != nil {
+			i.check.SetAttributes(LatestVersionKey.String(versionString(e.Version)))
+		}
+	case selfupdate.EventDownloadStarted:
+		i.startStage(e, "selfupdate.download")
+	case selfupdate.EventDownloadCompleted:
+		i.endStage(e, nil)
+		i.startStage(e, "selfupdate.verify")
+	case selfupdate.EventVerificationPassed:
+		i.endStage(e, nil)
+		i.startStage(e, "selfupdate.apply")
+	case selfupdate.EventInstalled:
+		i.endStage(e, nil)
+		i.installs.Add(context.Background(), 1, metric.WithAttributes(VersionKey.String(versionString(e.Version))))
+		i.version = versionString(e.Version)
+		i.endCheck(e, nil)
+	case selfupdate.EventStaged:
+		i.endCheck(e, nil)
+	case selfupdate.EventRollback:
+		if i.stage != nil {
+			i.stage.AddEvent("rollback", trace.WithTimestamp(e.Time))
+		}
+		if e.Err != nil {
+			i.failures.Add(context.Background(), 1, metric.WithAttributes(FailureKey.String(e.Kind.String())))
+		}
+	case selfupdate.EventDownloadFailed, selfupdate.EventVerificationFailed, selfupdate.EventInstallFailed:
+		i.fail(e)
+	}
+}
+
+func (i *Instrumentation) checked(e selfupdate.Event) {
+	i.checks.Add(context.Background(), 1, metric.WithAttributes(ResultKey.String(e.Kind.String())))
+}
+
+func (i *Instrumentation) fail(e selfupdate.Event) {
+	i.failures.Add(context.Background(), 1, metric.WithAttributes(FailureKey.String(e.Kind.String())))
+	i.endStage(e, e.Err)
+	i.endCheck(e, e.Err)
+}
+
+func (i *Instrumentation) startStage(e selfupdate.Event, name string) {
+	if i.check == nil {
+		return
+	}
+	_, i.stage = i.tracer.Start(i.ctx, name, trace.WithTimestamp(e.Time))
+}
+
+func (i *Instrumentation) endStage(e selfupdate.Event, err error) {
+	if i.stage == nil {
+		return
+	}
+	endSpan(i.stage, e, err)
+	i.stage = nil
+}
+
+func (i *Instrumentation) endCheck(e selfupdate.Event, err error) {
+	if i.check == nil {
+		return
+	}
+	i.endStage(e, err)
+	i.check.SetAttributes(ResultKey.String(e.Kind.String()))
+	endSpan(i.check, e, err)
+	i.check = nil
+	i.ctx = context.Background()
+}
+
+func endSpan(span trace.Span, e selfupdate.Event, err error) {
+	if err != nil {
+		span.RecordError(err, trace.WithTimestamp(e.Time))
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End(trace.WithTimestamp(e.Time))
+}
+
+// Source wraps a selfupdate.Source to record a span for each of its calls, as a child of the
+// check in progress, and the bytes and duration of the downloads.
+func (i *Instrumentation) Source(s selfupdate.Source) selfupdate.Source {
+	return &source{Source: s, i: i}
+}
+
+type source struct {
+	selfupdate.Source
+	i *Instrumentation
+}
+
+func (s *source) start(name string) (context.Context, trace.Span) {
+	s.i.lock.Lock()
+	ctx := s.i.ctx
+	s.i.lock.Unlock()
+
+	return s.i.tracer.Start(ctx, name)
+}
+
+func (s *source) Get(v *selfupdate.Version) (io.ReadCloser, int64, error) {
+	ctx, span := s.start("selfupdate.source.get")
+	r, contentLength, err := s.Source.Get(v)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		return r, contentLength, err
+	}
+	return &countingReader{ReadCloser: r, ctx: ctx, span: span, start: time.Now(), i: s.i}, contentLength, nil
+}
+
+func (s *source) GetSignature() ([64]byte, error) {
+	_, span := s.start("selfupdate.source.get_signature")
+	defer span.End()
+
+	signature, err := s.Source.GetSignature()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return signature, err
+}
+
+func (s *source) LatestVersion() (*selfupdate.Version, error) {
+	_, span := s.start("selfupdate.source.latest_version")
+	defer span.End()
+
+	v, err := s.Source.LatestVersion()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(LatestVersionKey.String(versionString(v)))
+	}
+	return v, err
+}
+
+// RecordInstall forwards to the wrapped source if it implements selfupdate.InstallRecorder
+func (s *source) RecordInstall(v *selfupdate.Version) error {
+	if recorder, ok := s.Source.(selfupdate.InstallRecorder); ok {
+		return recorder.RecordInstall(v)
+	}
+	return nil
+}
+
+// countingReader records the bytes read and end the Get span once closed
+type countingReader struct {
+	io.ReadCloser
+	ctx   context.Context
+	span  trace.Span
+	start time.Time
+	i     *Instrumentation
+	n     int64
+	once  sync.Once
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	if err != nil && err != io.EOF {
+		r.span.RecordError(err)
+		r.span.SetStatus(codes.Error, err.Error())
+	}
+	return n, err
+}
+
+func (r *countingReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(func() {
+		r.i.bytes.Add(r.ctx, r.n)
+		r.i.downloadDuration.Record(r.ctx, time.Since(r.start).Seconds())
+		r.span.SetAttributes(BytesKey.Int64(r.n))
+		r.span.End()
+	})
+	return err
+}
+
+func versionString(v *selfupdate.Version) string {
+	switch {
+	case v == nil:
+		return ""
+	case v.Number != "":
+		return v.Number
+	case v.Build != 0:
+		return "build-" + strconv.Itoa(v.Build)
+	case !v.Date.IsZero():
+		return v.Date.UTC().Format(time.RFC3339)
+	}
+	return ""
+}
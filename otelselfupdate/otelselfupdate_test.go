@@ -0,0 +1,187 @@
+package otelselfupdate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/solodyagin/selfupdate"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type testSource struct {
+	version *selfupdate.Version
+	err     error
+}
+
+func (s *testSource) Get(*selfupdate.Version) (io.ReadCloser, int64, error) {
+	return io.NopCloser(bytes.NewReader([]byte("new executable"))), 14, s.err
+}
+
+func (s *testSource) GetSignature() ([64]byte, error) {
+	return [64]byte{}, s.err
+}
+
+func (s *testSource) LatestVersion() (*selfupdate.Version, error) {
+	return s.version, s.err
+}
+
+func newTestInstrumentation(t *testing.T) (*Instrumentation, *tracetest.InMemoryExporter, *sdkmetric.ManualReader) {
+	exporter := tracetest.NewInMemoryExporter()
+	reader := sdkmetric.NewManualReader()
+
+	i, err := New(
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))),
+		WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))),
+	)
+	assert.Nil(t, err)
+	return i, exporter, reader
+}
+
+func collect(t *testing.T, reader *sdkmetric.ManualReader) map[string]metricdata.Aggregation {
+	rm := metricdata.ResourceMetrics{}
+	assert.Nil(t, reader.Collect(context.Background(), &rm))
+
+	metrics := map[string]metricdata.Aggregation{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+	return metrics
+}
+
+func sumWith(data metricdata.Aggregation, kv attribute.KeyValue) int64 {
+	var total int64
+	for _, dp := range data.(metricdata.Sum[int64]).DataPoints {
+		if v, ok := dp.Attributes.Value(kv.Key); ok && v == kv.Value {
+			total += dp.Value
+		}
+	}
+	return total
+}
+
+func TestCheckNow(t *testing.T) {
+	i, exporter, reader := newTestInstrumentation(t)
+
+	source := &testSource{version: &selfupdate.Version{Number: "1.0.0"}}
+	updater, err := selfupdate.Manage(&selfupdate.Config{
+		Current:   &selfupdate.Version{Number: "1.0.0"},
+		Source:    i.Source(source),
+		Observer:  i,
+		StatePath: filepath.Join(t.TempDir(), "state.json"),
+	})
+	assert.Nil(t, err)
+
+	assert.Nil(t, updater.CheckNow())
+	source.err = errors.New("unreachable")
+	assert.NotNil(t, updater.CheckNow())
+
+	spans := exporter.GetSpans()
+	names := []string{}
+	for _, span := range spans {
+		names = append(names, span.Name)
+	}
+	assert.Equal(t, []string{
+		"selfupdate.source.latest_version", "selfupdate.check",
+		"selfupdate.source.latest_version", "selfupdate.check",
+	}, names)
+	assert.Equal(t, spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID())
+	assert.Equal(t, codes.Error, spans[3].Status.Code)
+	assert.Contains(t, spans[1].Attributes, VersionKey.String("1.0.0"))
+
+	metrics := collect(t, reader)
+	assert.Equal(t, int64(1), sumWith(metrics["selfupdate.checks"], ResultKey.String("no_update")))
+	assert.Equal(t, int64(1), sumWith(metrics["selfupdate.checks"], ResultKey.String("check_failed")))
+	assert.Equal(t, int64(1), sumWith(metrics["selfupdate.failures"], FailureKey.String("check_failed")))
+
+	running := metrics["selfupdate.running"].(metricdata.Gauge[int64]).DataPoints
+	assert.Len(t, running, 1)
+	v, _ := running[0].Attributes.Value(VersionKey)
+	assert.Equal(t, "1.0.0", v.AsString())
+}
+
+func TestInstallEvents(t *testing.T) {
+	i, exporter, reader := newTestInstrumentation(t)
+	source := i.Source(&testSource{version: &selfupdate.Version{Number: "1.1.0"}})
+
+	current := &selfupdate.Version{Number: "1.0.0"}
+	latest := &selfupdate.Version{Number: "1.1.0"}
+	now := time.Now()
+	event := func(kind selfupdate.EventKind, v *selfupdate.Version, err error) {
+		now = now.Add(time.Millisecond)
+		i.OnEvent(selfupdate.Event{Kind: kind, Time: now, Version: v, Err: err})
+	}
+
+	event(selfupdate.EventCheckStarted, current, nil)
+	event(selfupdate.EventUpdateFound, latest, nil)
+	event(selfupdate.EventDownloadStarted, latest, nil)
+	r, _, err := source.Get(current)
+	assert.Nil(t, err)
+	_, err = io.ReadAll(r)
+	assert.Nil(t, err)
+	r.Close()
+	event(selfupdate.EventDownloadCompleted, latest, nil)
+	event(selfupdate.EventVerificationPassed, latest, nil)
+	event(selfupdate.EventInstalled, latest, nil)
+
+	event(selfupdate.EventCheckStarted, latest, nil)
+	event(selfupdate.EventUpdateFound, &selfupdate.Version{Number: "1.2.0"}, nil)
+	event(selfupdate.EventDownloadStarted, latest, nil)
+	event(selfupdate.EventDownloadCompleted, latest, nil)
+	event(selfupdate.EventVerificationFailed, latest, errors.New("invalid signature"))
+
+	names := map[string]int{}
+	for _, span := range exporter.GetSpans() {
+		names[span.Name]++
+		if span.Name == "selfupdate.source.get" {
+			assert.Contains(t, span.Attributes, BytesKey.Int64(14))
+		}
+		if span.Name == "selfupdate.verify" && names[span.Name] == 2 {
+			assert.Equal(t, codes.Error, span.Status.Code)
+		}
+	}
+	assert.Equal(t, map[string]int{
+		"selfupdate.check":      2,
+		"selfupdate.download":   2,
+		"selfupdate.verify":     2,
+		"selfupdate.apply":      1,
+		"selfupdate.source.get": 1,
+	}, names)
+
+	metrics := collect(t, reader)
+	assert.Equal(t, int64(2), sumWith(metrics["selfupdate.checks"], ResultKey.String("update_found")))
+	assert.Equal(t, int64(1), sumWith(metrics["selfupdate.installs"], VersionKey.String("1.1.0")))
+	assert.Equal(t, int64(1), sumWith(metrics["selfupdate.failures"], FailureKey.String("verification_failed")))
+	assert.Equal(t, int64(14), metrics["selfupdate.download.bytes"].(metricdata.Sum[int64]).DataPoints[0].Value)
+}
+
+func TestStagedEvents(t *testing.T) {
+	i, exporter, _ := newTestInstrumentation(t)
+
+	latest := &selfupdate.Version{Number: "1.1.0"}
+	now := time.Now()
+	for _, kind := range []selfupdate.EventKind{
+		selfupdate.EventCheckStarted, selfupdate.EventUpdateFound, selfupdate.EventDownloadStarted,
+		selfupdate.EventDownloadCompleted, selfupdate.EventVerificationPassed, selfupdate.EventStaged,
+	} {
+		now = now.Add(time.Millisecond)
+		i.OnEvent(selfupdate.Event{Kind: kind, Time: now, Version: latest})
+	}
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 4)
+	check := spans[len(spans)-1]
+	assert.Equal(t, "selfupdate.check", check.Name)
+	assert.Contains(t, check.Attributes, ResultKey.String("staged"))
+}
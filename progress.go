@@ -2,11 +2,166 @@ package selfupdate
 
 import (
 	"io"
+	"time"
 )
 
+// DefaultProgressInterval is the minimum delay between two progress call back when Config.ProgressInterval is not set
+const DefaultProgressInterval = 100 * time.Millisecond
+
+// ProgressPhase identify which part of the update process a Progress is about
+type ProgressPhase int
+
+const (
+	// PhaseDownload is reported while the update is being downloaded
+	PhaseDownload ProgressPhase = iota
+	// PhaseDecompress is reserved for an update decompressed while it is being downloaded, none
+	// of the sources provided serve a compressed update so it is not reported yet
+	PhaseDecompress
+	// PhasePatch is reported by Apply while a binary patch is applied to the executable
+	PhasePatch
+	// PhaseVerify is reported while the checksum and signature are being verified
+	PhaseVerify
+	// PhaseInstall is reported while the new executable is being written and swapped in place
+	PhaseInstall
+)
+
+// String return the name of the phase
+func (p ProgressPhase) String() string {
+	switch p {
+	case PhaseDownload:
+		return "download"
+	case PhaseDecompress:
+		return "decompress"
+	case PhasePatch:
+		return "patch"
+	case PhaseVerify:
+		return "verify"
+	case PhaseInstall:
+		return "install"
+	}
+	return "unknown"
+}
+
+// Progress describe how far a phase of the update process is
+type Progress struct {
+	Phase ProgressPhase // The phase in progress
+	Done  int64         // Bytes processed so far
+	Total int64         // Total bytes to process, zero or negative if unknown. It is set to Done once the phase is completed
+	Rate  float64       // Smoothed rate in bytes per second
+	ETA   time.Duration // Estimated time remaining, zero if unknown
+}
+
+// Fraction return the progress between 0.0 and 1.0, or a negative number if the total is unknown
+func (p Progress) Fraction() float64 {
+	if p.Total <= 0 {
+		return -1
+	}
+	return float64(p.Done) / float64(p.Total)
+}
+
+// progressSmoothing is the weight of the latest measure in the exponential moving average of the rate
+const progressSmoothing = 0.3
+
+type progressReporter struct {
+	callback func(Progress, error)
+	interval time.Duration
+	now      func() time.Time
+
+	phase    ProgressPhase
+	started  time.Time
+	last     time.Time
+	lastDone int64
+	rate     float64
+}
+
+// newProgressReporter combine the progress call back of the configuration with the ones
+// provided, it returns nil if there is none
+func newProgressReporter(conf *Config, extra ...func(Progress, error)) *progressReporter {
+	callbacks := extra
+	if conf.ProgressInfoCallback != nil {
+		callbacks = append(callbacks, conf.ProgressInfoCallback)
+	}
+	if conf.ProgressCallback != nil {
+		callbacks = append(callbacks, fractionProgress(conf.ProgressCallback))
+	}
+
+	interval := conf.ProgressInterval
+	if interval == 0 {
+		interval = DefaultProgressInterval
+	}
+
+	switch len(callbacks) {
+	case 0:
+		return nil
+	case 1:
+		return &progressReporter{callback: callbacks[0], interval: interval, now: time.Now}
+	}
+	return &progressReporter{
+		callback: func(p Progress, err error) {
+			for _, cb := range callbacks {
+				cb(p, err)
+			}
+		},
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// fractionProgress wraps a call back following the ProgressCallback convention: the download
+// progress between 0.0 and 1.0 or the unknown size as a negative (or zero) number.
+func fractionProgress(callback func(float64, error)) func(Progress, error) {
+	return func(p Progress, err error) {
+		if p.Phase != PhaseDownload {
+			return
+		}
+		if p.Total > 0 {
+			callback(p.Fraction(), err)
+		} else {
+			callback(float64(p.Total), err)
+		}
+	}
+}
+
+// report call back with the progress of a phase, throttled to one call per interval unless
+// the phase changed, is completed (done == total) or an error occurred.
+func (r *progressReporter) report(phase ProgressPhase, done int64, total int64, err error) {
+	if r == nil {
+		return
+	}
+
+	now := r.now()
+	if r.started.IsZero() || phase != r.phase {
+		r.phase = phase
+		r.started = now
+		r.last = now
+		r.lastDone = 0
+		r.rate = 0
+	} else if done != total && err == nil && now.Sub(r.last) < r.interval {
+		return
+	}
+
+	if elapsed := now.Sub(r.last).Seconds(); elapsed > 0 {
+		rate := float64(done-r.lastDone) / elapsed
+		if r.rate == 0 {
+			r.rate = rate
+		} else {
+			r.rate = progressSmoothing*rate + (1-progressSmoothing)*r.rate
+		}
+		r.last = now
+		r.lastDone = done
+	}
+
+	p := Progress{Phase: phase, Done: done, Total: total, Rate: r.rate}
+	if total > 0 && done < total && r.rate > 0 {
+		p.ETA = time.Duration(float64(total-done) / r.rate * float64(time.Second))
+	}
+	r.callback(p, err)
+}
+
 type progressReader struct {
 	io.Reader
-	progressCallback func(float64, error)
+	progressCallback func(float64, error) // used when no reporter is provided
+	reporter         *progressReporter
 	contentLength    int64
 	downloaded       int64
 }
@@ -17,14 +172,18 @@ func (pr *progressReader) Read(p []byte) (int, error) {
 	n, err := pr.Reader.Read(p)
 	pr.downloaded += int64(n)
 
-	if err != io.EOF {
-		if pr.contentLength > 0 {
-			pr.progressCallback(float64(pr.downloaded)/float64(pr.contentLength), err)
-		} else {
-			pr.progressCallback(float64(pr.contentLength), err)
+	if pr.reporter == nil {
+		if pr.progressCallback == nil {
+			return n, err
 		}
+		pr.reporter = &progressReporter{callback: fractionProgress(pr.progressCallback), now: time.Now}
+	}
+
+	if err != io.EOF {
+		pr.reporter.report(PhaseDownload, pr.downloaded, pr.contentLength, err)
 	} else {
-		pr.progressCallback(1, nil)
+		// the size is now known
+		pr.reporter.report(PhaseDownload, pr.downloaded, pr.downloaded, nil)
 	}
 
 	return n, err
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -48,3 +49,58 @@ func Test_ProgressReaderWithoutContentLength(t *testing.T) {
 	assert.Equal(t, float64(1), lastPercentage)
 	assert.Equal(t, data, r)
 }
+
+func Test_ProgressReporterThrottle(t *testing.T) {
+	now := time.Unix(1000, 0)
+	var reports []Progress
+	reporter := &progressReporter{
+		callback: func(p Progress, err error) { reports = append(reports, p) },
+		interval: time.Second,
+		now:      func() time.Time { return now },
+	}
+
+	reporter.report(PhaseDownload, 0, 4000, nil)
+	now = now.Add(100 * time.Millisecond)
+	reporter.report(PhaseDownload, 100, 4000, nil)
+	now = now.Add(900 * time.Millisecond)
+	reporter.report(PhaseDownload, 1000, 4000, nil)
+	assert.Len(t, reports, 2)
+	assert.Equal(t, float64(1000), reports[1].Rate)
+	assert.Equal(t, 3*time.Second, reports[1].ETA)
+	assert.Equal(t, 0.25, reports[1].Fraction())
+
+	now = now.Add(time.Second)
+	reporter.report(PhaseDownload, 3000, 4000, nil)
+	assert.Len(t, reports, 3)
+	assert.InDelta(t, 0.3*2000+0.7*1000, reports[2].Rate, 0.001)
+
+	now = now.Add(time.Millisecond)
+	reporter.report(PhaseDownload, 4000, 4000, nil)
+	assert.Len(t, reports, 4)
+	assert.Equal(t, time.Duration(0), reports[3].ETA)
+
+	reporter.report(PhaseVerify, 0, 4000, nil)
+	assert.Len(t, reports, 5)
+	assert.Equal(t, PhaseVerify, reports[4].Phase)
+	assert.Equal(t, float64(0), reports[4].Rate)
+	assert.Equal(t, "verify", reports[4].Phase.String())
+}
+
+func Test_ProgressReporterConfig(t *testing.T) {
+	assert.Nil(t, newProgressReporter(&Config{}))
+
+	var fractions []float64
+	var phases []ProgressPhase
+	reporter := newProgressReporter(&Config{
+		ProgressCallback:     func(f float64, err error) { fractions = append(fractions, f) },
+		ProgressInfoCallback: func(p Progress, err error) { phases = append(phases, p.Phase) },
+		ProgressInterval:     -1,
+	})
+
+	reporter.report(PhaseDownload, 0, -1, nil)
+	reporter.report(PhaseDownload, 10, -1, nil)
+	reporter.report(PhaseDownload, 20, 20, nil)
+	reporter.report(PhaseInstall, 20, 20, nil)
+	assert.Equal(t, []float64{-1, -1, 1}, fractions)
+	assert.Equal(t, []ProgressPhase{PhaseDownload, PhaseDownload, PhaseDownload, PhaseInstall}, phases)
+}
@@ -1,32 +1,104 @@
 package selfupdate
 
 import (
+	"errors"
 	"os"
 	"syscall"
+	"time"
 
 	"github.com/solodyagin/selfupdate/internal/osext"
 )
 
-func restart(exiter func(error), executable string) error {
-	wd, err := os.Getwd()
-	if err != nil {
-		return err
+// RestartStrategy define how the application is restarted once the update is installed
+type RestartStrategy int
+
+const (
+	// RestartFork start the new executable as a new process and exit, this is the default
+	RestartFork RestartStrategy = iota
+	// RestartExec replace the image of the running process by the new executable, keeping its PID
+	// and the file descriptors not flagged close-on-exec, so that supervisors like systemd, runit or
+	// docker keep track of it. On Windows, where this is not possible, it falls back to RestartFork.
+	RestartExec
+	// RestartExit only exit with Config.RestartExitCode and let the supervisor start the new executable
+	RestartExit
+	// RestartCustom call Config.RestartCallback with the path of the new executable
+	RestartCustom
+	// RestartGraceful start the new executable with the listeners created by Listen and wait for it
+	// to call Ready before calling Config.ExitCallback, which should stop accepting connections and
+	// drain the ones in progress, like http.Server.Shutdown does, then exit. The running process
+	// keeps serving if the new one is not ready within Config.RestartReadyTimeout.
+	// On Windows, where this is not possible, it falls back to RestartFork.
+	RestartGraceful
+	// RestartSystemd tell systemd the service is stopping and exit with Config.RestartExitCode, or
+	// DefaultSystemdExitCode if not set, for the service manager to start the new executable with
+	// Restart=on-failure, which does not restart a service exiting with 0.
+	// While updating, systemd is notified the service is reloading and its watchdog is fed.
+	// When NOTIFY_SOCKET is not set, as the process is not a systemd service, it falls back to RestartFork.
+	RestartSystemd
+)
+
+// DefaultSystemdExitCode is the exit code of RestartSystemd when Config.RestartExitCode is not set,
+// EX_TEMPFAIL so that systemd restarts the service with Restart=on-failure
+const DefaultSystemdExitCode = 75
+
+// DefaultRestartReadyTimeout is used by RestartGraceful when Config.RestartReadyTimeout is not set
+const DefaultRestartReadyTimeout = 30 * time.Second
+
+// String return the name of the strategy
+func (s RestartStrategy) String() string {
+	switch s {
+	case RestartFork:
+		return "fork"
+	case RestartExec:
+		return "exec"
+	case RestartExit:
+		return "exit"
+	case RestartCustom:
+		return "custom"
+	case RestartGraceful:
+		return "graceful"
+	case RestartSystemd:
+		return "systemd"
 	}
+	return "unknown"
+}
 
+func restart(conf *Config, executable string) error {
 	if executable == "" {
+		var err error
 		executable, err = osext.Executable()
 		if err != nil {
 			return err
 		}
 	}
 
-	_, err = os.StartProcess(executable, os.Args, &os.ProcAttr{
-		Dir:   wd,
-		Env:   os.Environ(),
-		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
-		Sys:   &syscall.SysProcAttr{},
-	})
+	switch conf.RestartStrategy {
+	case RestartExec:
+		return execRestart(conf, executable)
+	case RestartGraceful:
+		return gracefulRestart(conf, executable)
+	case RestartSystemd:
+		if systemdRunning() {
+			return systemdRestart(conf)
+		}
+	case RestartExit:
+		if conf.ExitCallback != nil {
+			conf.ExitCallback(nil)
+			return nil
+		}
+		os.Exit(conf.RestartExitCode)
+	case RestartCustom:
+		if conf.RestartCallback == nil {
+			return errors.New("custom restart strategy without RestartCallback")
+		}
+		return conf.RestartCallback(executable)
+	}
+	return forkRestart(conf.ExitCallback, executable)
+}
 
+// forkRestart start the executable as a new process with the same arguments and exit
+func forkRestart(exiter func(error), executable string) error {
+	err := startProcess(executable)
 	if exiter != nil {
 		exiter(err)
 	} else if err == nil {
@@ -34,3 +106,19 @@ func restart(exiter func(error), executable string) error {
 	}
 	return err
 }
+
+// startProcess start the executable as a new process with the same arguments, environment and standard files
+func startProcess(executable string) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	_, err = os.StartProcess(executable, os.Args, &os.ProcAttr{
+		Dir:   wd,
+		Env:   os.Environ(),
+		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
+		Sys:   &syscall.SysProcAttr{},
+	})
+	return err
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package selfupdate
+
+import (
+	"os"
+	"syscall"
+)
+
+// execRestart replace the running process by the executable, it only returns on failure
+func execRestart(_ *Config, executable string) error {
+	return syscall.Exec(executable, os.Args, os.Environ())
+}
@@ -0,0 +1,6 @@
+package selfupdate
+
+// execRestart fall back to starting a new process as Windows can not replace the running one
+func execRestart(conf *Config, executable string) error {
+	return forkRestart(conf.ExitCallback, executable)
+}
@@ -0,0 +1,110 @@
+//go:build !windows
+// +build !windows
+
+package selfupdate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// gracefulRestart start the executable with the listeners created by Listen and wait for it to
+// call Ready before exiting, so that no connection is refused in between. If the new process
+// does not get ready in time, it is killed and the running process keeps serving.
+func gracefulRestart(conf *Config, executable string) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	files, listeners, err := handoffFiles()
+	if err != nil {
+		return err
+	}
+	defer closeFiles(files)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	env := []string{listenersEnv + "=" + listeners, readyEnv + "=" + strconv.Itoa(3+len(files))}
+	for _, e := range os.Environ() {
+		if !strings.HasPrefix(e, listenersEnv+"=") && !strings.HasPrefix(e, readyEnv+"=") {
+			env = append(env, e)
+		}
+	}
+
+	fds, err := rawFds(append(append([]*os.File{os.Stdin, os.Stdout, os.Stderr}, files...), w))
+	if err != nil {
+		w.Close()
+		return err
+	}
+	pid, err := syscall.ForkExec(executable, os.Args, &syscall.ProcAttr{Dir: wd, Env: env, Files: fds})
+	w.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := waitReady(r, conf.RestartReadyTimeout); err != nil {
+		if process, ferr := os.FindProcess(pid); ferr == nil {
+			process.Kill()
+			process.Wait()
+		}
+		return err
+	}
+
+	keepUnixSockets()
+	if conf.ExitCallback != nil {
+		conf.ExitCallback(nil)
+		return nil
+	}
+	os.Exit(0)
+	return nil
+}
+
+// rawFds return the file descriptors of the files without putting them in blocking mode like
+// os.StartProcess does, which would also affect the listeners they are duplicated from and
+// prevent them from being closed while an Accept is in progress.
+func rawFds(files []*os.File) ([]uintptr, error) {
+	fds := make([]uintptr, len(files))
+	for i, f := range files {
+		conn, err := f.SyscallConn()
+		if err != nil {
+			return nil, err
+		}
+		if err := conn.Control(func(fd uintptr) { fds[i] = fd }); err != nil {
+			return nil, err
+		}
+	}
+	return fds, nil
+}
+
+// waitReady wait for the new process to write to the readiness pipe
+func waitReady(r *os.File, timeout time.Duration) error {
+	if timeout == 0 {
+		timeout = DefaultRestartReadyTimeout
+	}
+
+	ready := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 1))
+		ready <- err
+	}()
+
+	select {
+	case err := <-ready:
+		if err != nil {
+			return fmt.Errorf("new process exited before being ready: %w", err)
+		}
+		return nil
+	case <-time.After(timeout):
+		return errors.New("new process not ready after " + timeout.String())
+	}
+}
@@ -0,0 +1,6 @@
+package selfupdate
+
+// gracefulRestart fall back to starting a new process as Windows can not pass the listeners to it
+func gracefulRestart(conf *Config, executable string) error {
+	return forkRestart(conf.ExitCallback, executable)
+}
@@ -0,0 +1,95 @@
+//go:build !windows
+// +build !windows
+
+package selfupdate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRestartExecHelper is run as a child process by TestRestartExec, it print its PID then
+// restart in place to print it again
+func TestRestartExecHelper(t *testing.T) {
+	switch os.Getenv("SELFUPDATE_TEST_EXEC") {
+	case "":
+		t.Skip("only run by TestRestartExec")
+	case "before":
+		fmt.Printf("before %d\n", os.Getpid())
+		os.Setenv("SELFUPDATE_TEST_EXEC", "after")
+		executable, _ := os.Executable()
+		err := restart(&Config{RestartStrategy: RestartExec}, executable)
+		t.Fatalf("exec returned: %v", err)
+	case "after":
+		fmt.Printf("after %d\n", os.Getpid())
+	}
+}
+
+func TestRestartExec(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRestartExecHelper$")
+	cmd.Env = append(os.Environ(), "SELFUPDATE_TEST_EXEC=before")
+	out, err := cmd.Output()
+	assert.Nil(t, err)
+
+	var before, after int
+	for _, line := range strings.Split(string(out), "\n") {
+		fmt.Sscanf(line, "before %d", &before)
+		fmt.Sscanf(line, "after %d", &after)
+	}
+	assert.NotZero(t, before)
+	assert.Equal(t, before, after)
+}
+
+func TestRestartStrategies(t *testing.T) {
+	var exited []error
+	err := restart(&Config{RestartStrategy: RestartExit, ExitCallback: func(err error) { exited = append(exited, err) }}, "app")
+	assert.Nil(t, err)
+	assert.Equal(t, []error{nil}, exited)
+
+	var restarted string
+	failure := errors.New("failure")
+	err = restart(&Config{RestartStrategy: RestartCustom, RestartCallback: func(executable string) error {
+		restarted = executable
+		return failure
+	}}, "app")
+	assert.Equal(t, failure, err)
+	assert.Equal(t, "app", restarted)
+
+	assert.NotNil(t, restart(&Config{RestartStrategy: RestartCustom}, "app"))
+	assert.Equal(t, "exec", RestartExec.String())
+}
+
+func TestApplyOnExitSignals(t *testing.T) {
+	source, publicKey := newSignedTestSource(t, "1.1.0")
+	exited := make(chan error, 1)
+	u := newTestUpdater(t, &Config{
+		Current:      &Version{Number: "1.0.0"},
+		Source:       source,
+		PublicKey:    publicKey,
+		ExitCallback: func(err error) { exited <- err },
+	})
+	assert.Nil(t, u.Stage())
+
+	stop := u.ApplyOnExitSignals(syscall.SIGUSR1)
+	defer stop()
+	assert.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+
+	select {
+	case err := <-exited:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("ExitCallback not called")
+	}
+	assert.Nil(t, u.Pending())
+	content, err := os.ReadFile(u.target)
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, content)
+}
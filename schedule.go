@@ -0,0 +1,234 @@
+package selfupdate
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Clock provide the time to the scheduler of an Updater, it can be replaced to test a Schedule
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// MaintenanceWindow define a period of the day when an update can be installed
+type MaintenanceWindow struct {
+	Weekdays []time.Weekday // Days the window opens, every day if empty
+	Start    time.Duration  // Time of the day the window opens, as a duration since midnight
+	Duration time.Duration  // How long the window stays open, it can go past midnight
+	Location *time.Location // Time zone of Start, time.Local if nil
+}
+
+// contains reports whether the window is open at t
+func (w MaintenanceWindow) contains(t time.Time) bool {
+	// a window opened on one of the previous days may still be open
+	for days := 0; days <= int((w.Start+w.Duration)/(24*time.Hour)); days++ {
+		start := w.opening(t, -days)
+		if w.openOn(start) && !t.Before(start) && t.Before(start.Add(w.Duration)) {
+			return true
+		}
+	}
+	return false
+}
+
+// next return the first time the window opens after t
+func (w MaintenanceWindow) next(t time.Time) time.Time {
+	for days := 0; days <= 7; days++ {
+		start := w.opening(t, days)
+		if w.openOn(start) && start.After(t) {
+			return start
+		}
+	}
+	return time.Time{}
+}
+
+// opening return when the window opens on the day of t moved by the number of days
+func (w MaintenanceWindow) opening(t time.Time, days int) time.Time {
+	location := w.Location
+	if location == nil {
+		location = time.Local
+	}
+	t = t.In(location)
+	midnight := time.Date(t.Year(), t.Month(), t.Day()+days, 0, 0, 0, 0, location)
+	return midnight.Add(w.Start)
+}
+
+func (w MaintenanceWindow) openOn(start time.Time) bool {
+	if len(w.Weekdays) == 0 {
+		return true
+	}
+	for _, day := range w.Weekdays {
+		if start.Weekday() == day {
+			return true
+		}
+	}
+	return false
+}
+
+// scheduler trigger the update checks of an Updater according to its Schedule
+type scheduler struct {
+	updater *Updater
+	clock   Clock
+	cron    *cronSchedule
+	jitter  func(limit time.Duration) time.Duration
+	last    time.Time // when the scheduler last triggered, or the last check persisted before a restart
+}
+
+func newScheduler(u *Updater) (*scheduler, error) {
+	s := &scheduler{updater: u, clock: u.conf.Clock, jitter: randomJitter, last: u.store().get().LastCheck}
+	if s.clock == nil {
+		s.clock = systemClock{}
+	}
+
+	if expr := u.conf.Schedule.Cron; expr != "" {
+		var err error
+		if s.cron, err = parseCron(expr); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// randomJitter return a random delay up to limit
+func randomJitter(limit time.Duration) time.Duration {
+	if limit <= 0 {
+		return 0
+	}
+	return rand.N(limit)
+}
+
+// run check for update on start if asked to and then every time the schedule trigger
+func (s *scheduler) run() {
+	log := s.updater.logger()
+	if s.updater.conf.Schedule.FetchOnStart {
+		log.Info("Doing an initial upgrade check")
+		s.last = s.clock.Now()
+		// errors are already logged by the updater
+		_ = s.trigger()
+	}
+
+	for {
+		now := s.clock.Now()
+		next := s.next(now)
+		s.updater.recordNextCheck(next)
+		if next.IsZero() {
+			return
+		}
+
+		delay := next.Sub(now)
+		<-s.clock.After(delay)
+		s.updater.recordNextCheck(time.Time{})
+		log.Info("Scheduled upgrade check", "delay", delay)
+		s.last = s.clock.Now()
+		_ = s.trigger()
+	}
+}
+
+// next return when the scheduler should trigger after now, the zero time if never. The
+// schedule follows the last trigger, even from before a restart, so that a check missed
+// while the application was not running is done right away.
+func (s *scheduler) next(now time.Time) time.Time {
+	schedule := s.updater.conf.Schedule
+
+	var next time.Time
+	earliest := func(t time.Time) {
+		if !t.IsZero() && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+
+	from := now
+	if !s.last.IsZero() && s.last.Before(now) {
+		from = s.last
+	}
+	if schedule.Interval > 0 {
+		earliest(from.Add(schedule.Interval))
+	}
+	if schedule.At.Repeating != None {
+		earliest(nextTriggerAt(schedule.At.Repeating, schedule.At.Time, from))
+	}
+	if s.cron != nil {
+		earliest(s.cron.next(from))
+	}
+	if !next.IsZero() {
+		if next.Before(now) {
+			next = now
+		}
+		next = next.Add(s.jitter(schedule.Jitter))
+	}
+
+	// an update staged outside of the maintenance windows is installed once one opens
+	if pending := s.updater.Pending(); pending != nil && !s.updater.installOnExit(pending) {
+		for _, w := range schedule.Windows {
+			earliest(w.next(now))
+		}
+	}
+	return next
+}
+
+// trigger check for update and install it if a maintenance window is open, otherwise only
+// download it to be installed in the next window. An update the user decided to install on exit
+// is left staged.
+func (s *scheduler) trigger() error {
+	if !s.inWindow(s.clock.Now()) {
+		return s.updater.Stage()
+	}
+	if pending := s.updater.Pending(); pending != nil && !s.updater.installOnExit(pending) {
+		return s.updater.Commit()
+	}
+	return s.updater.CheckNow()
+}
+
+// inWindow reports whether an update can be installed at t, always if there is no maintenance window
+func (s *scheduler) inWindow(t time.Time) bool {
+	windows := s.updater.conf.Schedule.Windows
+	if len(windows) == 0 {
+		return true
+	}
+	for _, w := range windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextTriggerAt return the first time strictly after now matching the repeating pattern at the offset
+func nextTriggerAt(repeating Repeating, offset time.Time, now time.Time) time.Time {
+	location := offset.Location()
+	now = now.In(location)
+	at := func(month time.Month, day int, hour int) time.Time {
+		return time.Date(now.Year(), month, day, hour, offset.Minute(), offset.Second(), offset.Nanosecond(), location)
+	}
+
+	// the slot of the current period may still be ahead, otherwise it is the one of the next period
+	for i := 0; i < 3; i++ {
+		var next time.Time
+		switch repeating {
+		case Hourly:
+			next = at(now.Month(), now.Day(), now.Hour()+i)
+		case Daily:
+			next = at(now.Month(), now.Day()+i, offset.Hour())
+		case Weekly:
+			days := (int(offset.Weekday()) - int(now.Weekday()) + 7) % 7
+			next = at(now.Month(), now.Day()+days+7*i, offset.Hour())
+		case Monthly:
+			month := now.Month() + time.Month(i)
+			// the 31st is the last day of shorter months
+			last := time.Date(now.Year(), month+1, 0, 0, 0, 0, 0, location).Day()
+			next = at(month, min(offset.Day(), last), offset.Hour())
+		default:
+			return time.Time{}
+		}
+
+		if next.After(now) {
+			return next
+		}
+	}
+	return time.Time{}
+}
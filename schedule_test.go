@@ -0,0 +1,164 @@
+package selfupdate
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock let a test follow the scheduler, every wait is sent to waits and the time only
+// moves forward by the duration waited when the test call advance
+type fakeClock struct {
+	lock  sync.Mutex
+	now   time.Time
+	wait  time.Duration
+	timer chan time.Time
+	waits chan time.Duration
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, waits: make(chan time.Duration)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	timer := make(chan time.Time, 1)
+	c.lock.Lock()
+	c.wait, c.timer = d, timer
+	c.lock.Unlock()
+
+	c.waits <- d
+	return timer
+}
+
+// advance move the time to the end of the last wait
+func (c *fakeClock) advance() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(c.wait)
+	c.timer <- c.now
+}
+
+func TestNextTriggerAt(t *testing.T) {
+	// a wednesday
+	now := time.Date(2024, 5, 15, 10, 30, 0, 0, time.UTC)
+	// a monday
+	monday := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		repeating Repeating
+		offset    time.Time
+		next      time.Time
+	}{
+		{Hourly, time.Date(0, 0, 0, 0, 42, 0, 0, time.UTC), time.Date(2024, 5, 15, 10, 42, 0, 0, time.UTC)},
+		{Hourly, time.Date(0, 0, 0, 0, 12, 0, 0, time.UTC), time.Date(2024, 5, 15, 11, 12, 0, 0, time.UTC)},
+		{Daily, time.Date(0, 0, 0, 12, 0, 0, 0, time.UTC), time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)},
+		{Daily, time.Date(0, 0, 0, 3, 0, 0, 0, time.UTC), time.Date(2024, 5, 16, 3, 0, 0, 0, time.UTC)},
+		{Weekly, monday, time.Date(2024, 5, 20, 9, 0, 0, 0, time.UTC)},
+		{Weekly, monday.AddDate(0, 0, 2).Add(2 * time.Hour), time.Date(2024, 5, 15, 11, 0, 0, 0, time.UTC)},
+		{Weekly, monday.AddDate(0, 0, 2), time.Date(2024, 5, 22, 9, 0, 0, 0, time.UTC)},
+		{Monthly, time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC)},
+		{Monthly, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{None, monday, time.Time{}},
+	} {
+		assert.Equal(t, tc.next, nextTriggerAt(tc.repeating, tc.offset, now), "%v %v", tc.repeating, tc.offset)
+	}
+
+	// the last day of a shorter month
+	next := nextTriggerAt(Monthly, time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), next)
+}
+
+func TestMaintenanceWindow(t *testing.T) {
+	// from 22:00 to 02:00 on saturday and sunday nights
+	w := MaintenanceWindow{
+		Weekdays: []time.Weekday{time.Saturday, time.Sunday},
+		Start:    22 * time.Hour,
+		Duration: 4 * time.Hour,
+		Location: time.UTC,
+	}
+
+	saturday := time.Date(2024, 5, 18, 0, 0, 0, 0, time.UTC)
+	assert.False(t, w.contains(saturday))
+	assert.False(t, w.contains(saturday.Add(21*time.Hour)))
+	assert.True(t, w.contains(saturday.Add(22*time.Hour)))
+	assert.True(t, w.contains(saturday.Add(25*time.Hour)))
+	assert.False(t, w.contains(saturday.Add(26*time.Hour)))
+	assert.True(t, w.contains(saturday.Add(47*time.Hour)))
+	assert.True(t, w.contains(saturday.Add(49*time.Hour)))
+	assert.False(t, w.contains(saturday.Add(71*time.Hour)))
+
+	wednesday := time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, saturday.Add(22*time.Hour), w.next(wednesday))
+	assert.Equal(t, saturday.Add(46*time.Hour), w.next(saturday.Add(22*time.Hour)))
+}
+
+func TestSchedulerNext(t *testing.T) {
+	now := time.Date(2024, 5, 15, 10, 30, 0, 0, time.UTC)
+	updater := newTestUpdater(t, &Config{Schedule: Schedule{
+		Interval: 2 * time.Hour,
+		Cron:     "CRON_TZ=UTC 0 11 * * *",
+		Jitter:   10 * time.Minute,
+	}})
+
+	s, err := newScheduler(updater)
+	assert.Nil(t, err)
+	s.jitter = func(limit time.Duration) time.Duration { return limit / 2 }
+	assert.Equal(t, time.Date(2024, 5, 15, 11, 5, 0, 0, time.UTC), s.next(now))
+
+	updater.conf.Schedule = Schedule{At: ScheduleAt{Repeating: Weekly, Time: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)}}
+	s, err = newScheduler(updater)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2024, 5, 20, 9, 0, 0, 0, time.UTC), s.next(now))
+
+	updater.conf.Schedule = Schedule{}
+	s, err = newScheduler(updater)
+	assert.Nil(t, err)
+	assert.True(t, s.next(now).IsZero())
+
+	updater.conf.Schedule.Cron = "61 * * * *"
+	_, err = newScheduler(updater)
+	assert.NotNil(t, err)
+}
+
+func TestSchedulerMaintenanceWindow(t *testing.T) {
+	source, publicKey := newSignedTestSource(t, "1.2.0")
+	var events []EventKind
+	clock := newFakeClock(time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC))
+	updater := newTestUpdater(t, &Config{
+		Current:   &Version{Number: "1.0.0"},
+		Source:    source,
+		PublicKey: publicKey,
+		Observer:  ObserverFunc(func(e Event) { events = append(events, e.Kind) }),
+		Clock:     clock,
+		Schedule: Schedule{
+			Interval: 24 * time.Hour,
+			Windows:  []MaintenanceWindow{{Start: 2 * time.Hour, Duration: 2 * time.Hour, Location: time.UTC}},
+		},
+	})
+
+	s, err := newScheduler(updater)
+	assert.Nil(t, err)
+	go s.run()
+
+	// checked outside of the window, the update is only downloaded
+	assert.Equal(t, 24*time.Hour, <-clock.waits)
+	clock.advance()
+	// then installed once the window opens
+	assert.Equal(t, 16*time.Hour, <-clock.waits)
+	assert.Equal(t, "1.2.0", updater.Pending().Number)
+	assert.Contains(t, events, EventStaged)
+	assert.NotContains(t, events, EventInstalled)
+	clock.advance()
+
+	assert.Equal(t, 24*time.Hour, <-clock.waits)
+	assert.Nil(t, updater.Pending())
+	assert.Contains(t, events, EventInstalled)
+}
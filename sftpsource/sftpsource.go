@@ -0,0 +1,250 @@
+// Package sftpsource provide a selfupdate.Source that will download the update from an SSH server
+// over SFTP. It lives in its own package so that applications that do not use SFTP do not depend
+// on the SSH libraries.
+//
+//	config := &selfupdate.Config{
+//		Source: sftpsource.New("files.example.com:22", sshConfig, "/srv/releases/myapp-{{.OS}}-{{.Arch}}{{.Ext}}"),
+//		...
+//	}
+package sftpsource
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sync"
+
+	"github.com/pkg/sftp"
+	"github.com/solodyagin/selfupdate"
+	"golang.org/x/crypto/ssh"
+)
+
+// Source provide a selfupdate.Source that will download the update from an SSH server over SFTP.
+// It is expecting the signature file to be next to the executable at ${path}.ed25519
+type Source struct {
+	addr     string
+	config   *ssh.ClientConfig
+	path     string
+	manifest string
+
+	lock   sync.Mutex
+	binary string
+}
+
+var _ selfupdate.Source = (*Source)(nil)
+
+// Option configure a Source
+type Option func(*Source)
+
+// WithManifest read the release information from a JSON manifest, in the same format as the
+// one of selfupdate.NewManifestSource, when it is present at the specified remote path. Its url,
+// if any, is relative to the manifest and replace the executable path given to New.
+func WithManifest(path string) Option {
+	return func(s *Source) {
+		s.manifest = selfupdate.ExpandTemplate(path)
+	}
+}
+
+// New provide a selfupdate.Source that will connect to the SSH server at addr (host:port)
+// using the client config provided and read the executable at the specified remote path. The path
+// is a Go Template string that recognize the same parameters as selfupdate.NewHTTPSource. Unless a manifest
+// is present, the version of the update is the modification time of the executable.
+// A new connection is established for each operation and Get keeps it open until the
+// returned io.ReadCloser is closed.
+func New(addr string, config *ssh.ClientConfig, path string, opts ...Option) selfupdate.Source {
+	s := &Source{addr: addr, config: config, path: selfupdate.ExpandTemplate(path)}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Get will return if it succeed an io.ReaderCloser to the new executable being downloaded and its size
+func (s *Source) Get(v *selfupdate.Version) (io.ReadCloser, int64, error) {
+	client, err := s.connect("get")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	binary, err := s.binaryPath(client)
+	if err != nil {
+		client.Close()
+		return nil, 0, err
+	}
+
+	f, err := client.Open(binary)
+	if err != nil {
+		client.Close()
+		return nil, 0, selfupdate.NewSourceError("get", s.location(binary), err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		client.Close()
+		return nil, 0, selfupdate.NewSourceError("get", s.location(binary), err)
+	}
+
+	return &sftpFile{File: f, client: client}, info.Size(), nil
+}
+
+// GetSignature will return the content of ${path}.ed25519
+func (s *Source) GetSignature() ([64]byte, error) {
+	client, err := s.connect("get signature")
+	if err != nil {
+		return [64]byte{}, err
+	}
+	defer client.Close()
+
+	binary, err := s.binaryPath(client)
+	if err != nil {
+		return [64]byte{}, err
+	}
+
+	f, err := client.Open(binary + ".ed25519")
+	if err != nil {
+		return [64]byte{}, selfupdate.NewSourceError("get signature", s.location(binary+".ed25519"), err)
+	}
+	defer f.Close()
+
+	size := int64(-1)
+	if info, err := f.Stat(); err == nil {
+		size = info.Size()
+	}
+	r, err := selfupdate.ReadSignature(f, size)
+	if err != nil {
+		return [64]byte{}, selfupdate.NewSourceError("get signature", s.location(binary+".ed25519"), err)
+	}
+	return r, nil
+}
+
+// LatestVersion will return the release information of the manifest if present, otherwise the
+// remote modification time and size of the executable
+func (s *Source) LatestVersion() (*selfupdate.Version, error) {
+	client, err := s.connect("latest version")
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	manifest, binary, err := s.readManifest(client)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	s.binary = binary
+	s.lock.Unlock()
+
+	info, err := client.Stat(binary)
+	if err != nil {
+		return nil, selfupdate.NewSourceError("latest version", s.location(binary), err)
+	}
+
+	if manifest == nil {
+		return &selfupdate.Version{Date: info.ModTime(), Size: info.Size()}, nil
+	}
+	v := manifest.Release()
+	if v.Size == 0 {
+		v.Size = info.Size()
+	}
+	return v, nil
+}
+
+// sftpClient closes the SSH connection along with the SFTP session
+type sftpClient struct {
+	*sftp.Client
+	conn *ssh.Client
+}
+
+func (c *sftpClient) Close() error {
+	err := c.Client.Close()
+	if cerr := c.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// sftpFile closes the connection it was opened from along with the file
+type sftpFile struct {
+	*sftp.File
+	client *sftpClient
+}
+
+func (f *sftpFile) Close() error {
+	err := f.File.Close()
+	if cerr := f.client.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (s *Source) connect(op string) (*sftpClient, error) {
+	conn, err := ssh.Dial("tcp", s.addr, s.config)
+	if err != nil {
+		return nil, selfupdate.NewSourceError(op, s.location(s.path), err)
+	}
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, selfupdate.NewSourceError(op, s.location(s.path), err)
+	}
+	return &sftpClient{Client: client, conn: conn}, nil
+}
+
+// binaryPath return the executable found by the last LatestVersion, looking it up if needed
+func (s *Source) binaryPath(client *sftpClient) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.binary != "" {
+		return s.binary, nil
+	}
+
+	_, binary, err := s.readManifest(client)
+	if err != nil {
+		return "", err
+	}
+	s.binary = binary
+	return binary, nil
+}
+
+// readManifest return the manifest if one is configured and present, along with the path of the executable
+func (s *Source) readManifest(client *sftpClient) (*selfupdate.Manifest, string, error) {
+	if s.manifest == "" {
+		return nil, s.path, nil
+	}
+
+	f, err := client.Open(s.manifest)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, s.path, nil
+	}
+	if err != nil {
+		return nil, "", selfupdate.NewSourceError("latest version", s.location(s.manifest), err)
+	}
+	defer f.Close()
+
+	manifest := &selfupdate.Manifest{}
+	if err := json.NewDecoder(f).Decode(manifest); err != nil {
+		return nil, "", selfupdate.NewSourceError("latest version", s.location(s.manifest), fmt.Errorf("%w: invalid manifest: %w", selfupdate.ErrNoVersion, err))
+	}
+	if manifest.URL == "" {
+		return manifest, s.path, nil
+	}
+
+	binary := selfupdate.ExpandTemplate(manifest.URL)
+	if !path.IsAbs(binary) {
+		binary = path.Join(path.Dir(s.manifest), binary)
+	}
+	return manifest, binary, nil
+}
+
+func (s *Source) location(p string) string {
+	if !path.IsAbs(p) {
+		p = "/" + p
+	}
+	return "sftp://" + s.addr + p
+}
@@ -0,0 +1,164 @@
+package sftpsource
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/solodyagin/selfupdate"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+var newFile = []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+
+func writeRelease(t *testing.T, path string, content []byte, date time.Time) {
+	assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.Nil(t, os.WriteFile(path+".ed25519", make([]byte, 64), 0644))
+	assert.Nil(t, os.WriteFile(path, content, 0644))
+	assert.Nil(t, os.Chtimes(path, date, date))
+}
+
+// sftpServer serves the directory over SFTP to the clients authenticating with the password "secret"
+func sftpServer(t *testing.T, dir string) (string, *ssh.ClientConfig) {
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	assert.Nil(t, err)
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(_ ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) != "secret" {
+				return nil, errors.New("access denied")
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSFTP(conn, config, dir)
+		}
+	}()
+
+	return listener.Addr().String(), &ssh.ClientConfig{
+		User:            "app",
+		Auth:            []ssh.AuthMethod{ssh.Password("secret")},
+		HostKeyCallback: ssh.FixedHostKey(signer.PublicKey()),
+		Timeout:         5 * time.Second,
+	}
+}
+
+func serveSFTP(conn net.Conn, config *ssh.ServerConfig, dir string) {
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+
+		go func() {
+			for req := range requests {
+				// the payload is the length prefixed subsystem name
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if !ok {
+					continue
+				}
+
+				server, err := sftp.NewServer(channel, sftp.WithServerWorkingDirectory(dir))
+				if err != nil {
+					channel.Close()
+					return
+				}
+				server.Serve()
+				server.Close()
+				return
+			}
+		}()
+	}
+}
+
+func TestSource(t *testing.T) {
+	dir := t.TempDir()
+	date := time.Date(2022, 6, 22, 10, 0, 0, 0, time.UTC)
+	writeRelease(t, filepath.Join(dir, "app-"+runtime.GOOS), newFile, date)
+	addr, config := sftpServer(t, dir)
+
+	source := New(addr, config, "app-{{.OS}}")
+	version, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.True(t, date.Equal(version.Date))
+	assert.Equal(t, int64(len(newFile)), version.Size)
+
+	signature, err := source.GetSignature()
+	assert.Nil(t, err)
+	assert.Equal(t, [64]byte{}, signature)
+
+	r, size, err := source.Get(version)
+	assert.Nil(t, err)
+	content, err := io.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Nil(t, r.Close())
+	assert.Equal(t, newFile, content)
+	assert.Equal(t, int64(len(newFile)), size)
+
+	_, err = New(addr, config, "missing").LatestVersion()
+	var se *selfupdate.SourceError
+	assert.True(t, errors.As(err, &se))
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+	assert.Equal(t, "sftp://"+addr+"/missing", se.Location)
+
+	wrongPassword := *config
+	wrongPassword.Auth = []ssh.AuthMethod{ssh.Password("guess")}
+	_, err = New(addr, &wrongPassword, "app-{{.OS}}").LatestVersion()
+	assert.True(t, errors.As(err, &se))
+}
+
+func TestSourceManifest(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "1.2.0"), 0755))
+	writeRelease(t, filepath.Join(dir, "1.2.0", "app"), newFile, time.Now())
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(`{"version": "1.2.0", "url": "1.2.0/app"}`), 0644))
+	addr, config := sftpServer(t, dir)
+
+	source := New(addr, config, "app", WithManifest("manifest.json"))
+	version, err := source.LatestVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.0", version.Number)
+	assert.Equal(t, int64(len(newFile)), version.Size)
+
+	r, _, err := source.Get(version)
+	assert.Nil(t, err)
+	content, err := io.ReadAll(r)
+	r.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, content)
+}
@@ -1,6 +1,8 @@
 package selfupdate
 
 import (
+	"bytes"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -16,6 +18,19 @@ type Source interface {
 	LatestVersion() (*Version, error)           // Get the latest version information to determine if we should trigger an update
 }
 
+// InstallRecorder can be implemented by a Source that needs to know when a version it served
+// has been installed, for example to make the following checks conditional to it.
+type InstallRecorder interface {
+	RecordInstall(*Version) error
+}
+
+// ExpandTemplate fill the {{.OS}}, {{.Arch}}, {{.Ext}} and {{.Executable}} parameters of a Go
+// Template string the way NewHTTPSource does, for the Source implemented outside of this package.
+// The template is returned as is if it is invalid.
+func ExpandTemplate(template string) string {
+	return replaceURLTemplate(template)
+}
+
 func replaceURLTemplate(base string) string {
 	ext := ""
 	if runtime.GOOS == "windows" {
@@ -52,3 +67,58 @@ func replaceURLTemplate(base string) string {
 	}
 	return buf.String()
 }
+
+// ReadSignature reads an ed25519 signature, size is the announced length of the content. It is
+// provided for the Source implemented outside of this package, an unexpected length is reported
+// as ErrSignatureMalformed.
+func ReadSignature(r io.Reader, size int64) ([64]byte, error) {
+	return readSignature(r, size)
+}
+
+// readSignature reads an ed25519 signature, size is the announced length of the content
+func readSignature(r io.Reader, size int64) ([64]byte, error) {
+	if size != 64 {
+		return [64]byte{}, fmt.Errorf("%w: ed25519 signature must be 64 bytes long and was %v", ErrSignatureMalformed, size)
+	}
+
+	writer := bytes.NewBuffer(make([]byte, 0, 64))
+	n, err := io.Copy(writer, io.LimitReader(r, 65))
+	if err != nil {
+		return [64]byte{}, err
+	}
+
+	if n != 64 {
+		return [64]byte{}, fmt.Errorf("%w: ed25519 signature must be 64 bytes long and was %v", ErrSignatureMalformed, n)
+	}
+
+	s := [64]byte{}
+	copy(s[:], writer.Bytes())
+
+	return s, nil
+}
+
+// writeFileAtomic replace the content of a file by writing to a temporary file in the same
+// directory and renaming it, so that readers never see a partially written file.
+func writeFileAtomic(path string, content []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(f.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
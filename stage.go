@@ -0,0 +1,272 @@
+package selfupdate
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// stagedUpdate describe the update staged next to the target, the executable being stored
+// at .${name}.staged and this description at .${name}.staged.json
+type stagedUpdate struct {
+	Version   *Version `json:"version"`
+	Checksum  string   `json:"checksum"`  // hex encoded SHA-256 of the staged executable
+	Signature string   `json:"signature"` // hex encoded ed25519 signature of the staged executable
+}
+
+// Stage check for an update like CheckNow, but only download and verify it into a staging path
+// next to the executable. The update is installed by Commit or, at the next start of the
+// application, by ApplyStagedOnStartup. Nothing is downloaded if the latest version is already staged.
+func (u *Updater) Stage() error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	log := u.logger().With("source", fmt.Sprintf("%T", u.conf.Source))
+
+	current, latest, _, err := u.check(log)
+	if err != nil || latest == nil {
+		return err
+	}
+	return u.stage(log, current, latest)
+}
+
+// stage download and verify the latest version into the staging path
+func (u *Updater) stage(log *slog.Logger, current *Version, latest *Version) error {
+	if pending := u.Pending(); pending != nil && sameRelease(pending, latest) {
+		log.Debug("The latest version is already staged", "latest", latest)
+		return nil
+	}
+
+	opts, newBytes, err := u.download(log, current, latest)
+	if errors.Is(err, ErrNoUpdate) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := writeStaged(opts.TargetPath, latest, newBytes, opts.Signature); err != nil {
+		log.Error("Unable to stage the update", "latest", latest, "error", err)
+		u.emit(EventInstallFailed, latest, err)
+		return newApplyError(StageInstall, err)
+	}
+
+	log.Info("Update staged", "version", current, "latest", latest, "bytes", len(newBytes))
+	u.emit(EventStaged, latest, nil)
+	return nil
+}
+
+// Pending return the version staged by Stage and not installed yet, nil if there is none
+func (u *Updater) Pending() *Version {
+	target, err := (&Options{TargetPath: u.target}).getPath()
+	if err != nil {
+		return nil
+	}
+
+	staged, err := readStagedUpdate(target)
+	if err != nil || staged == nil {
+		return nil
+	}
+	return staged.Version
+}
+
+// Commit install the update staged by Stage and restart the application like CheckNow would.
+// ErrNoUpdate is returned if no update is staged.
+func (u *Updater) Commit() error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	log := u.logger()
+
+	staged, err := u.installStaged(log)
+	if err != nil {
+		return err
+	}
+	if staged == nil {
+		return ErrNoUpdate
+	}
+	return u.restartAfterUpdate(log, staged)
+}
+
+// installStaged verify and install the staged update, without any network access. It return the
+// version installed, nil if no update is staged.
+func (u *Updater) installStaged(log *slog.Logger) (*Version, error) {
+	target, err := (&Options{TargetPath: u.target}).getPath()
+	if err != nil {
+		return nil, err
+	}
+
+	staged, newBytes, err := readStaged(target)
+	if err != nil {
+		log.Error("Unable to read the staged update", "error", err)
+		return nil, err
+	}
+	if staged == nil {
+		return nil, nil
+	}
+
+	opts, err := verifyStaged(target, staged, newBytes, u.conf.PublicKey)
+	if err != nil {
+		log.Error("Unable to verify the staged update", "latest", staged.Version, "error", err)
+		u.emit(EventVerificationFailed, staged.Version, err)
+		return nil, err
+	}
+
+	ready := u.systemdReloading(log, staged.Version)
+	err = u.install(log, opts, newBytes, u.conf.Current, staged.Version)
+	ready()
+	if err != nil {
+		return nil, err
+	}
+	return staged.Version, nil
+}
+
+// ApplyStagedOnStartup install the update staged by Updater.Stage, if any, and restart the
+// application in place with RestartExec. The staged executable is verified again against the
+// public key, the same as Config.PublicKey, as it could have been replaced since it was staged.
+// It is meant to be called at the very beginning of main, before anything else runs, and only
+// return if there is no staged update or if it could not be installed.
+func ApplyStagedOnStartup(publicKey ed25519.PublicKey) error {
+	target, err := ExecutableRealPath()
+	if err != nil {
+		return err
+	}
+
+	v, err := applyStaged(target, publicKey)
+	if err != nil || v == nil {
+		return err
+	}
+	return restart(&Config{RestartStrategy: RestartExec}, target)
+}
+
+// applyStaged install the update staged next to the target and return its version, nil if there is none
+func applyStaged(target string, publicKey ed25519.PublicKey) (*Version, error) {
+	staged, newBytes, err := readStaged(target)
+	if err != nil || staged == nil {
+		return nil, err
+	}
+
+	opts, err := verifyStaged(target, staged, newBytes, publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := opts.install(newBytes); err != nil {
+		return nil, newApplyError(StageInstall, err)
+	}
+	removeStaged(target)
+	return staged.Version, nil
+}
+
+// verifyStaged check that the staged executable was not altered and is still signed by the private
+// key matching the public key, it is discarded otherwise
+func verifyStaged(target string, staged *stagedUpdate, newBytes []byte, publicKey ed25519.PublicKey) (*Options, error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return nil, newApplyError(StagePrepare, fmt.Errorf("%w: no ed25519 public key to verify the staged update with", ErrInvalidPublicKey))
+	}
+
+	checksum, err := hex.DecodeString(staged.Checksum)
+	if err != nil {
+		removeStaged(target)
+		return nil, newApplyError(StageVerify, fmt.Errorf("%w: invalid staged checksum: %w", ErrChecksumMismatch, err))
+	}
+	signature, err := hex.DecodeString(staged.Signature)
+	if err == nil && len(signature) != ed25519.SignatureSize {
+		err = fmt.Errorf("%d bytes instead of %d", len(signature), ed25519.SignatureSize)
+	}
+	if err != nil {
+		removeStaged(target)
+		return nil, newApplyError(StageVerify, fmt.Errorf("%w: invalid staged signature: %w", ErrSignatureMalformed, err))
+	}
+
+	opts := &Options{TargetPath: target, Checksum: checksum, PublicKey: publicKey, Signature: signature}
+	if err := opts.prepare(); err != nil {
+		return nil, newApplyError(StagePrepare, err)
+	}
+	if err := opts.verify(newBytes); err != nil {
+		removeStaged(target)
+		return nil, newApplyError(StageVerify, err)
+	}
+	return opts, nil
+}
+
+func stagedPaths(target string) (binary string, description string) {
+	binary = filepath.Join(filepath.Dir(target), "."+filepath.Base(target)+".staged")
+	return binary, binary + ".json"
+}
+
+// writeStaged store the executable before its description, so that an interrupted staging is never applied
+func writeStaged(target string, v *Version, newBytes []byte, signature []byte) error {
+	binary, description := stagedPaths(target)
+
+	checksum := sha256.Sum256(newBytes)
+	content, err := json.Marshal(&stagedUpdate{
+		Version:   v,
+		Checksum:  hex.EncodeToString(checksum[:]),
+		Signature: hex.EncodeToString(signature),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(binary, newBytes, 0600); err != nil {
+		return err
+	}
+	return writeFileAtomic(description, content, 0600)
+}
+
+// readStagedUpdate return the description of the staged update, nil if there is none
+func readStagedUpdate(target string) (*stagedUpdate, error) {
+	_, description := stagedPaths(target)
+
+	content, err := os.ReadFile(description)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	staged := &stagedUpdate{}
+	if err := json.Unmarshal(content, staged); err != nil {
+		return nil, fmt.Errorf("invalid staged update %s: %w", description, err)
+	}
+	if staged.Version == nil {
+		return nil, fmt.Errorf("invalid staged update %s: no version", description)
+	}
+	return staged, nil
+}
+
+// readStaged return the description and the executable of the staged update, nil if there is none
+func readStaged(target string) (*stagedUpdate, []byte, error) {
+	staged, err := readStagedUpdate(target)
+	if err != nil {
+		removeStaged(target)
+		return nil, nil, err
+	}
+	if staged == nil {
+		return nil, nil, nil
+	}
+
+	binary, _ := stagedPaths(target)
+	newBytes, err := os.ReadFile(binary)
+	if err != nil {
+		removeStaged(target)
+		return nil, nil, err
+	}
+	return staged, newBytes, nil
+}
+
+func removeStaged(target string) {
+	binary, description := stagedPaths(target)
+	// the description first, so that a partial removal is never applied
+	_ = os.Remove(description)
+	_ = os.Remove(binary)
+}
@@ -0,0 +1,121 @@
+package selfupdate
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStageCommit(t *testing.T) {
+	source, publicKey := newSignedTestSource(t, "1.1.0")
+
+	var kinds []EventKind
+	u := newTestUpdater(t, &Config{
+		Current:   &Version{Number: "1.0.0"},
+		Source:    source,
+		PublicKey: publicKey,
+		Observer:  ObserverFunc(func(e Event) { kinds = append(kinds, e.Kind) }),
+	})
+
+	assert.Nil(t, u.Pending())
+	assert.True(t, errors.Is(u.Commit(), ErrNoUpdate))
+
+	assert.Nil(t, u.Stage())
+	assert.Equal(t, []EventKind{
+		EventCheckStarted, EventUpdateFound, EventDownloadStarted, EventDownloadCompleted,
+		EventVerificationPassed, EventStaged,
+	}, kinds)
+	assert.Equal(t, "1.1.0", u.Pending().Number)
+
+	// the target is left untouched until the update is committed
+	content, err := os.ReadFile(u.target)
+	assert.Nil(t, err)
+	assert.Equal(t, oldFile, content)
+
+	// already staged
+	kinds = nil
+	source.version = &Version{Number: "1.1.0"}
+	u.conf.Source = &mirrorSource{testSource: source, getErr: errors.New("unreachable")}
+	assert.Nil(t, u.Stage())
+	assert.Equal(t, []EventKind{EventCheckStarted, EventUpdateFound}, kinds)
+	assert.Equal(t, "1.1.0", u.Pending().Number)
+
+	kinds = nil
+	assert.Nil(t, u.Commit())
+	assert.Equal(t, []EventKind{EventInstalled, EventRestartPending}, kinds)
+	assert.Nil(t, u.Pending())
+
+	content, err = os.ReadFile(u.target)
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, content)
+}
+
+func TestApplyStaged(t *testing.T) {
+	source, publicKey := newSignedTestSource(t, "1.1.0")
+	u := newTestUpdater(t, &Config{Current: &Version{Number: "1.0.0"}, Source: source, PublicKey: publicKey})
+
+	v, err := applyStaged(u.target, publicKey)
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+
+	assert.Nil(t, u.Stage())
+	v, err = applyStaged(u.target, publicKey)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.1.0", v.Number)
+	assert.Nil(t, u.Pending())
+
+	content, err := os.ReadFile(u.target)
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, content)
+
+	// an altered staged executable is discarded
+	writeOldFile(u.target, t)
+	assert.Nil(t, u.Stage())
+	binary, _ := stagedPaths(u.target)
+	assert.Nil(t, os.WriteFile(binary, []byte("tampered"), 0600))
+
+	_, err = applyStaged(u.target, publicKey)
+	assert.True(t, errors.Is(err, ErrChecksumMismatch))
+	assert.Nil(t, u.Pending())
+
+	content, err = os.ReadFile(u.target)
+	assert.Nil(t, err)
+	assert.Equal(t, oldFile, content)
+}
+
+func TestApplyStagedSignature(t *testing.T) {
+	source, publicKey := newSignedTestSource(t, "1.1.0")
+	u := newTestUpdater(t, &Config{Current: &Version{Number: "1.0.0"}, Source: source, PublicKey: publicKey})
+
+	// the staged update is kept until it can be verified
+	assert.Nil(t, u.Stage())
+	_, err := applyStaged(u.target, nil)
+	assert.True(t, errors.Is(err, ErrInvalidPublicKey))
+	assert.Equal(t, "1.1.0", u.Pending().Number)
+
+	// signed with another key
+	_, otherKey := newSignedTestSource(t, "1.1.0")
+	_, err = applyStaged(u.target, otherKey)
+	assert.True(t, errors.Is(err, ErrSignatureInvalid))
+	assert.Nil(t, u.Pending())
+
+	// replaced along with its checksum
+	assert.Nil(t, u.Stage())
+	var signature [64]byte
+	assert.Nil(t, writeStaged(u.target, &Version{Number: "1.1.0"}, []byte("tampered"), signature[:]))
+	_, err = applyStaged(u.target, publicKey)
+	assert.True(t, errors.Is(err, ErrSignatureInvalid))
+	assert.Nil(t, u.Pending())
+
+	// staged without a signature
+	assert.Nil(t, writeStaged(u.target, &Version{Number: "1.1.0"}, newFile, nil))
+	_, err = applyStaged(u.target, publicKey)
+	assert.True(t, errors.Is(err, ErrSignatureMalformed))
+	assert.Nil(t, u.Pending())
+
+	content, err := os.ReadFile(u.target)
+	assert.Nil(t, err)
+	assert.Equal(t, oldFile, content)
+}
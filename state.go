@@ -0,0 +1,293 @@
+package selfupdate
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDeclineDelay is the delay before asking again for an update the user declined when Config.DeclineDelay is not set
+const DefaultDeclineDelay = 24 * time.Hour
+
+// maxFailedAttempts is the number of times a version can fail to be verified before it is skipped
+const maxFailedAttempts = 3
+
+// failedExpiry is how long a version that failed to be verified too many times is skipped
+const failedExpiry = 7 * 24 * time.Hour
+
+// stateVersion is the version of the format of the state file, a file written by a newer
+// version of the package is ignored rather than misread
+const stateVersion = 1
+
+// persistedState is what the Updater remember across restarts of the application
+type persistedState struct {
+	Version        int                     `json:"version"`
+	InstallationID string                  `json:"installation_id"`
+	LastCheck      time.Time               `json:"last_check,omitempty"`
+	LastResult     string                  `json:"last_result,omitempty"`
+	LastError      string                  `json:"last_error,omitempty"`
+	Declined       *declinedUpdate         `json:"declined,omitempty"`
+	Skipped        []string                `json:"skipped,omitempty"` // versionKey of the versions the user decided to skip
+	OnExit         string                  `json:"on_exit,omitempty"` // versionKey of the update staged to be installed on exit
+	Failed         map[string]*failedState `json:"failed,omitempty"`  // by versionKey
+}
+
+// declinedUpdate is the last update the user declined
+type declinedUpdate struct {
+	Version string    `json:"version"` // versionKey of the update
+	At      time.Time `json:"at"`
+	Until   time.Time `json:"until,omitempty"` // when to propose it again, At + Config.DeclineDelay if not set
+}
+
+// failedState count the failures to verify a version
+type failedState struct {
+	Attempts int       `json:"attempts"`
+	Last     time.Time `json:"last"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// stateStore keep the persisted state in memory and write it atomically on every change. If the
+// file can not be read or written, the state is only kept in memory.
+type stateStore struct {
+	path string
+
+	lock  sync.Mutex
+	state persistedState
+}
+
+// defaultStatePath return selfupdate/${name}.json under the user config directory
+func defaultStatePath(executable string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	name := strings.TrimSuffix(filepath.Base(executable), filepath.Ext(executable))
+	return filepath.Join(dir, "selfupdate", name+".json"), nil
+}
+
+// openStateStore read the state at path, starting from an empty state if it is missing,
+// unreadable or corrupted
+func openStateStore(path string, log *slog.Logger) *stateStore {
+	s := &stateStore{path: path, state: persistedState{Version: stateVersion}}
+	if path == "" {
+		return s
+	}
+
+	state, err := readState(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		log.Warn("Unable to read the updater state, starting from scratch", "path", path, "error", err)
+	default:
+		s.state = *state
+	}
+	return s
+}
+
+func readState(path string) (*persistedState, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &persistedState{}
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, fmt.Errorf("corrupted state: %w", err)
+	}
+	if state.Version != stateVersion {
+		return nil, fmt.Errorf("unsupported state version %d", state.Version)
+	}
+	return state, nil
+}
+
+// get return a copy of the state
+func (s *stateStore) get() persistedState {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	state := s.state
+	state.Skipped = slices.Clone(s.state.Skipped)
+	if state.Declined != nil {
+		declined := *state.Declined
+		state.Declined = &declined
+	}
+	state.Failed = make(map[string]*failedState, len(s.state.Failed))
+	for key, failed := range s.state.Failed {
+		f := *failed
+		state.Failed[key] = &f
+	}
+	return state
+}
+
+// update modify the state and save it
+func (s *stateStore) update(fn func(*persistedState)) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	fn(&s.state)
+	if s.path == "" {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(&s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, content, 0o600)
+}
+
+// store return the state of the Updater, reading it the first time
+func (u *Updater) store() *stateStore {
+	u.stateOnce.Do(func() {
+		log := u.logger()
+		path := u.conf.StatePath
+		if path == "" {
+			executable, err := (&Options{TargetPath: u.target}).getPath()
+			if err == nil {
+				path, err = defaultStatePath(executable)
+			}
+			if err != nil {
+				log.Warn("Unable to locate the updater state, it will not persist", "error", err)
+			}
+		}
+		u.state = openStateStore(path, log)
+	})
+	return u.state
+}
+
+// saveState update the persisted state, logging the failure to save it
+func (u *Updater) saveState(fn func(*persistedState)) {
+	if err := u.store().update(fn); err != nil {
+		u.logger().Warn("Unable to save the updater state", "path", u.store().path, "error", err)
+	}
+}
+
+// InstallationID return a random identifier of this installation of the application, generated
+// the first time and persisted with the updater state
+func (u *Updater) InstallationID() string {
+	if id := u.store().get().InstallationID; id != "" {
+		return id
+	}
+
+	var id string
+	u.saveState(func(state *persistedState) {
+		if state.InstallationID == "" {
+			b := make([]byte, 16)
+			rand.Read(b)
+			state.InstallationID = hex.EncodeToString(b)
+		}
+		id = state.InstallationID
+	})
+	return id
+}
+
+// persistEvent remember the outcome of the update process
+func (u *Updater) persistEvent(e Event) {
+	switch e.Kind {
+	case EventCheckStarted:
+		u.saveState(func(state *persistedState) {
+			state.LastCheck, state.LastResult, state.LastError = e.Time, "", ""
+		})
+	case EventVerificationFailed:
+		// unlike an install that may fail on a full disk or a missing permission, an update that
+		// does not match its checksum or signature will fail again
+		u.saveState(func(state *persistedState) {
+			if state.Failed == nil {
+				state.Failed = map[string]*failedState{}
+			}
+			key := versionKey(e.Version)
+			failed := state.Failed[key]
+			if failed == nil {
+				failed = &failedState{}
+				state.Failed[key] = failed
+			}
+			failed.Attempts++
+			failed.Last = e.Time
+			failed.Error = errorString(e.Err)
+			state.LastResult, state.LastError = e.Kind.String(), errorString(e.Err)
+		})
+	case EventInstalled:
+		u.saveState(func(state *persistedState) {
+			state.Declined, state.Failed, state.OnExit = nil, nil, ""
+			state.LastResult, state.LastError = e.Kind.String(), ""
+		})
+	case EventNoUpdate, EventUpdateDeclined, EventCheckFailed, EventDownloadFailed, EventInstallFailed, EventStaged:
+		u.saveState(func(state *persistedState) {
+			state.LastResult, state.LastError = e.Kind.String(), errorString(e.Err)
+		})
+	}
+}
+
+// skipVersion tell why the latest version should not be proposed, if it is already staged to be
+// installed on exit or, unless it is mandatory, if it failed to be verified too many times recently
+// or if the user skipped it or declined it recently, an empty string otherwise
+func (u *Updater) skipVersion(info *UpgradeInfo) string {
+	state := u.store().get()
+	key := versionKey(info.Latest)
+
+	if state.OnExit == key && sameRelease(u.Pending(), info.Latest) {
+		return "staged to be installed on exit"
+	}
+	if info.Mandatory {
+		return ""
+	}
+	if failed := state.Failed[key]; failed != nil && failed.Attempts >= maxFailedAttempts && time.Since(failed.Last) < failedExpiry {
+		return "failed to be verified too many times"
+	}
+	if slices.Contains(state.Skipped, key) {
+		return "skipped by the user"
+	}
+
+	if declined := state.Declined; declined != nil && declined.Version == key {
+		until := declined.Until
+		if until.IsZero() {
+			delay := u.conf.DeclineDelay
+			if delay == 0 {
+				delay = DefaultDeclineDelay
+			}
+			if delay < 0 {
+				return ""
+			}
+			until = declined.At.Add(delay)
+		}
+		if time.Now().Before(until) {
+			return "declined recently"
+		}
+	}
+	return ""
+}
+
+// versionKey identify a release in the persisted state
+func versionKey(v *Version) string {
+	if v == nil {
+		return ""
+	}
+	key := v.Number
+	if v.Build != 0 {
+		key += fmt.Sprintf("+%d", v.Build)
+	}
+	if !v.Date.IsZero() {
+		key += "@" + v.Date.UTC().Format(time.RFC3339)
+	}
+	return key
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
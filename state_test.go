@@ -0,0 +1,180 @@
+package selfupdate
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatePersisted(t *testing.T) {
+	source, publicKey := newSignedTestSource(t, "1.2.0")
+	path := filepath.Join(t.TempDir(), "state.json")
+	asked := 0
+	conf := func() *Config {
+		return &Config{
+			Current:                &Version{Number: "1.0.0"},
+			Source:                 source,
+			PublicKey:              publicKey,
+			StatePath:              path,
+			UpgradeConfirmCallback: func(string) bool { asked++; return false },
+		}
+	}
+
+	updater := newTestUpdater(t, conf())
+	id := updater.InstallationID()
+	assert.Len(t, id, 32)
+	assert.Nil(t, updater.CheckNow())
+	assert.Equal(t, 1, asked)
+
+	// after a restart
+	updater = newTestUpdater(t, conf())
+	assert.Equal(t, id, updater.InstallationID())
+	status := updater.Status()
+	assert.False(t, status.LastCheck.IsZero())
+	assert.Equal(t, EventUpdateDeclined, status.LastResult)
+
+	// the declined update is not proposed again right away
+	assert.Nil(t, updater.CheckNow())
+	assert.Equal(t, 1, asked)
+
+	updater.conf.DeclineDelay = -1
+	assert.Nil(t, updater.CheckNow())
+	assert.Equal(t, 2, asked)
+}
+
+func TestStateFailedVersion(t *testing.T) {
+	source, publicKey := newSignedTestSource(t, "1.2.0")
+	source.signature[0] ^= 0xff
+	var events []EventKind
+	updater := newTestUpdater(t, &Config{
+		Current:   &Version{Number: "1.0.0"},
+		Source:    source,
+		PublicKey: publicKey,
+		Observer:  ObserverFunc(func(e Event) { events = append(events, e.Kind) }),
+	})
+
+	for i := 0; i < maxFailedAttempts; i++ {
+		assert.ErrorIs(t, updater.CheckNow(), ErrSignatureInvalid)
+	}
+
+	events = nil
+	assert.Nil(t, updater.CheckNow())
+	assert.Equal(t, []EventKind{EventCheckStarted, EventNoUpdate}, events)
+
+	// a mandatory update is tried anyway
+	source.version = &Version{Number: "1.2.0", Critical: true}
+	assert.ErrorIs(t, updater.CheckNow(), ErrSignatureInvalid)
+	source.version = &Version{Number: "1.2.0"}
+
+	// tried again once the failures expired
+	updater.saveState(func(state *persistedState) {
+		state.Failed[versionKey(source.version)].Last = time.Now().Add(-failedExpiry)
+	})
+	assert.ErrorIs(t, updater.CheckNow(), ErrSignatureInvalid)
+
+	// or were cleared
+	assert.Nil(t, updater.CheckNow())
+	assert.Nil(t, updater.ClearSkippedVersions())
+	assert.ErrorIs(t, updater.CheckNow(), ErrSignatureInvalid)
+
+	// a newer version is tried
+	source.version = &Version{Number: "1.2.1"}
+	assert.ErrorIs(t, updater.CheckNow(), ErrSignatureInvalid)
+}
+
+func TestStateInstallFailureNotCounted(t *testing.T) {
+	source, publicKey := newSignedTestSource(t, "1.2.0")
+	updater := newTestUpdater(t, &Config{
+		Current:   &Version{Number: "1.0.0"},
+		Source:    source,
+		PublicKey: publicKey,
+	})
+	updater.target = filepath.Join(t.TempDir(), "missing", "target")
+
+	for i := 0; i <= maxFailedAttempts; i++ {
+		assert.NotNil(t, updater.CheckNow())
+	}
+	assert.Empty(t, updater.store().get().Failed)
+	assert.Equal(t, EventInstallFailed.String(), updater.store().get().LastResult)
+}
+
+func TestStateCorrupted(t *testing.T) {
+	for name, content := range map[string]string{
+		"corrupted": `{"version": 1, "installation_id": `,
+		"newer":     `{"version": 2, "installation_id": "from the future"}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "state.json")
+			assert.Nil(t, os.WriteFile(path, []byte(content), 0o600))
+
+			source, publicKey := newSignedTestSource(t, "1.0.0")
+			updater := newTestUpdater(t, &Config{
+				Current:   &Version{Number: "1.0.0"},
+				Source:    source,
+				PublicKey: publicKey,
+				StatePath: path,
+			})
+			assert.True(t, updater.Status().LastCheck.IsZero())
+			assert.Nil(t, updater.CheckNow())
+			assert.NotEqual(t, "from the future", updater.InstallationID())
+
+			// replaced by a valid state
+			state, err := readState(path)
+			assert.Nil(t, err)
+			assert.Equal(t, stateVersion, state.Version)
+			assert.Equal(t, EventNoUpdate.String(), state.LastResult)
+		})
+	}
+}
+
+func TestStateUnreadable(t *testing.T) {
+	parent := filepath.Join(t.TempDir(), "file")
+	assert.Nil(t, os.WriteFile(parent, nil, 0o600))
+
+	source, publicKey := newSignedTestSource(t, "1.0.0")
+	updater := newTestUpdater(t, &Config{
+		Current:   &Version{Number: "1.0.0"},
+		Source:    source,
+		PublicKey: publicKey,
+		StatePath: filepath.Join(parent, "state.json"),
+	})
+
+	// kept in memory
+	assert.Nil(t, updater.CheckNow())
+	assert.False(t, updater.Status().LastCheck.IsZero())
+	id := updater.InstallationID()
+	assert.NotEmpty(t, id)
+	assert.Equal(t, id, updater.InstallationID())
+}
+
+func TestSchedulerLastCheck(t *testing.T) {
+	now := time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		lastCheck time.Time
+		wait      time.Duration
+	}{
+		{now.Add(-23 * time.Hour), time.Hour},
+		{now.Add(-48 * time.Hour), 0},
+	} {
+		path := filepath.Join(t.TempDir(), "state.json")
+		content, _ := json.Marshal(&persistedState{Version: stateVersion, LastCheck: tc.lastCheck})
+		assert.Nil(t, os.WriteFile(path, content, 0o600))
+
+		clock := newFakeClock(now)
+		updater := newTestUpdater(t, &Config{
+			Source:    &testSource{err: ErrNoUpdate},
+			Clock:     clock,
+			StatePath: path,
+			Schedule:  Schedule{Interval: 24 * time.Hour},
+		})
+
+		s, err := newScheduler(updater)
+		assert.Nil(t, err)
+		go s.run()
+		assert.Equal(t, tc.wait, <-clock.waits)
+	}
+}
@@ -0,0 +1,119 @@
+package selfupdate
+
+import (
+	"errors"
+	"time"
+)
+
+// UpdaterState describe what an Updater is doing
+type UpdaterState int
+
+const (
+	// StateIdle is used while the Updater waits for the next check
+	StateIdle UpdaterState = iota
+	// StateChecking is used while the latest version is being fetched and confirmed
+	StateChecking
+	// StateDownloading is used while the update is being downloaded and verified
+	StateDownloading
+	// StateInstalling is used while the new executable replaces the current one
+	StateInstalling
+	// StateRestartPending is used once the update is installed, until the application is restarted
+	StateRestartPending
+)
+
+// String return the name of the state
+func (s UpdaterState) String() string {
+	switch s {
+	case StateIdle:
+		return "idle"
+	case StateChecking:
+		return "checking"
+	case StateDownloading:
+		return "downloading"
+	case StateInstalling:
+		return "installing"
+	case StateRestartPending:
+		return "restart_pending"
+	}
+	return "unknown"
+}
+
+// Status describe what an Updater is doing and what it found so far
+type Status struct {
+	State      UpdaterState // What the Updater is doing
+	Running    *Version     // The version currently running, as known by the last check if Config.Current is not set
+	LastCheck  time.Time    // When the last check started, zero if there was none
+	LastResult EventKind    // The event that concluded the last check, like EventNoUpdate, EventInstalled or EventStaged
+	LastError  error        // The error of the last check, nil if it succeeded
+	NextCheck  time.Time    // When the scheduler will check next, zero if no check is scheduled
+	Latest     *Version     // The latest version found by the last check, nil if none was newer
+	Progress   *Progress    // The progress of the download or install in progress, nil if none
+	Staged     *Version     // The version staged by Stage and not installed yet, nil if none
+}
+
+// Status return what the Updater is doing and what it found. It does not wait for the
+// check in progress, so it can be called at any time, for example to display it.
+func (u *Updater) Status() Status {
+	u.statusLock.Lock()
+	status := u.status
+	if status.Progress != nil {
+		progress := *status.Progress
+		status.Progress = &progress
+	}
+	u.statusLock.Unlock()
+
+	if status.Running == nil {
+		status.Running = u.conf.Current
+	}
+	if status.LastCheck.IsZero() {
+		// the last check done before the application restarted
+		state := u.store().get()
+		status.LastCheck, status.LastResult = state.LastCheck, eventKindFromString(state.LastResult)
+		if state.LastError != "" {
+			status.LastError = errors.New(state.LastError)
+		}
+	}
+	status.Staged = u.Pending()
+	return status
+}
+
+// recordEvent update the status with an event of the update process
+func (u *Updater) recordEvent(e Event) {
+	u.statusLock.Lock()
+	defer u.statusLock.Unlock()
+
+	switch e.Kind {
+	case EventCheckStarted:
+		u.status.State, u.status.LastCheck, u.status.Running = StateChecking, e.Time, e.Version
+		u.status.Latest, u.status.LastError = nil, nil
+	case EventUpdateFound:
+		u.status.Latest = e.Version
+	case EventDownloadStarted:
+		u.status.State, u.status.Progress = StateDownloading, nil
+	case EventRestartPending:
+		u.status.State, u.status.Progress = StateRestartPending, nil
+	case EventNoUpdate, EventUpdateDeclined, EventCheckFailed, EventDownloadFailed, EventVerificationFailed,
+		EventInstallFailed, EventInstalled, EventStaged:
+		u.status.State, u.status.Progress = StateIdle, nil
+		u.status.LastResult, u.status.LastError = e.Kind, e.Err
+	}
+}
+
+// recordProgress update the status with the progress of the download or install
+func (u *Updater) recordProgress(p Progress, err error) {
+	u.statusLock.Lock()
+	defer u.statusLock.Unlock()
+
+	if p.Phase == PhaseInstall {
+		u.status.State = StateInstalling
+	}
+	u.status.Progress = &p
+}
+
+// recordNextCheck update the status with the next time the scheduler will check
+func (u *Updater) recordNextCheck(next time.Time) {
+	u.statusLock.Lock()
+	defer u.statusLock.Unlock()
+
+	u.status.NextCheck = next
+}
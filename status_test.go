@@ -0,0 +1,97 @@
+package selfupdate
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatus(t *testing.T) {
+	source, publicKey := newSignedTestSource(t, "1.2.0")
+	states := map[EventKind]UpdaterState{}
+	var updater *Updater
+	updater = newTestUpdater(t, &Config{
+		Current:   &Version{Number: "1.0.0"},
+		Source:    source,
+		PublicKey: publicKey,
+		// Status is called while CheckNow holds the lock
+		Observer: ObserverFunc(func(e Event) { states[e.Kind] = updater.Status().State }),
+	})
+
+	status := updater.Status()
+	assert.Equal(t, StateIdle, status.State)
+	assert.True(t, status.LastCheck.IsZero())
+	assert.Equal(t, "1.0.0", status.Running.Number)
+
+	start := time.Now()
+	assert.Nil(t, updater.CheckNow())
+	assert.Equal(t, map[EventKind]UpdaterState{
+		EventCheckStarted:       StateChecking,
+		EventUpdateFound:        StateChecking,
+		EventDownloadStarted:    StateDownloading,
+		EventDownloadCompleted:  StateDownloading,
+		EventVerificationPassed: StateDownloading,
+		EventInstalled:          StateIdle,
+		EventRestartPending:     StateRestartPending,
+	}, states)
+
+	status = updater.Status()
+	assert.Equal(t, StateRestartPending, status.State)
+	assert.False(t, status.LastCheck.Before(start))
+	assert.Equal(t, EventInstalled, status.LastResult)
+	assert.Nil(t, status.LastError)
+	assert.Equal(t, "1.2.0", status.Latest.Number)
+	assert.Equal(t, "1.0.0", status.Running.Number)
+	assert.Nil(t, status.Progress)
+	assert.Nil(t, status.Staged)
+}
+
+func TestStatusFailure(t *testing.T) {
+	source, publicKey := newSignedTestSource(t, "1.2.0")
+	mirror := &mirrorSource{testSource: source}
+	updater := newTestUpdater(t, &Config{
+		Current:   &Version{Number: "1.0.0"},
+		Source:    mirror,
+		PublicKey: publicKey,
+	})
+
+	var progress []Progress
+	updater.conf.ProgressInfoCallback = func(p Progress, err error) {
+		progress = append(progress, *updater.Status().Progress)
+	}
+
+	assert.Nil(t, updater.Stage())
+	status := updater.Status()
+	assert.Equal(t, StateIdle, status.State)
+	assert.Equal(t, EventStaged, status.LastResult)
+	assert.Equal(t, "1.2.0", status.Staged.Number)
+	assert.NotEmpty(t, progress)
+
+	down := errors.New("unreachable")
+	mirror.getErr = down
+	assert.ErrorIs(t, updater.CheckNow(), down)
+	status = updater.Status()
+	assert.Equal(t, StateIdle, status.State)
+	assert.Equal(t, EventDownloadFailed, status.LastResult)
+	assert.ErrorIs(t, status.LastError, down)
+	assert.Equal(t, "1.2.0", status.Staged.Number)
+}
+
+func TestStatusNextCheck(t *testing.T) {
+	now := time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC)
+	clock := newFakeClock(now)
+	updater := newTestUpdater(t, &Config{
+		Source:   &testSource{err: ErrNoUpdate},
+		Clock:    clock,
+		Schedule: Schedule{Interval: time.Hour},
+	})
+
+	s, err := newScheduler(updater)
+	assert.Nil(t, err)
+	go s.run()
+
+	assert.Equal(t, time.Hour, <-clock.waits)
+	assert.Equal(t, now.Add(time.Hour), updater.Status().NextCheck)
+}
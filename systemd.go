@@ -0,0 +1,127 @@
+package selfupdate
+
+import (
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// systemdRunning reports whether the process is a systemd service expected to notify its state
+func systemdRunning() bool {
+	return os.Getenv("NOTIFY_SOCKET") != ""
+}
+
+// systemdNotify send the state to the service manager through the socket at NOTIFY_SOCKET,
+// it does nothing when not running under systemd
+func systemdNotify(state ...string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if socket[0] == '@' {
+		// abstract namespace socket
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(strings.Join(state, "\n")))
+	return err
+}
+
+// systemdWatchdog return the interval at which the service manager expects to be pinged by
+// this process, 0 if its watchdog is not enabled
+func systemdWatchdog() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// feedWatchdog ping the systemd watchdog at half its interval when RestartSystemd is used, until
+// the returned function is called, so that a long download does not get the service killed
+func (u *Updater) feedWatchdog() (stop func()) {
+	interval := systemdWatchdog() / 2
+	if u.conf.RestartStrategy != RestartSystemd || interval <= 0 || !systemdRunning() {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				systemdNotify("WATCHDOG=1")
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// systemdReloading tell systemd the service is being updated when RestartSystemd is used, the
+// returned function tell it the service is ready again
+func (u *Updater) systemdReloading(log *slog.Logger, latest *Version) (ready func()) {
+	if u.conf.RestartStrategy != RestartSystemd || !systemdRunning() {
+		return func() {}
+	}
+
+	status := "STATUS=Updating"
+	if latest.Number != "" {
+		status += " to " + latest.Number
+	}
+	if err := systemdNotify("RELOADING=1", status); err != nil {
+		log.Warn("Unable to notify systemd", "error", err)
+	}
+
+	return func() {
+		if err := systemdNotify("READY=1", "STATUS="); err != nil {
+			log.Warn("Unable to notify systemd", "error", err)
+		}
+	}
+}
+
+// systemdRestart tell systemd the service is stopping and exit with the exit code configured,
+// DefaultSystemdExitCode if not set, for the service manager to start the new executable. An
+// ExitCallback is expected to exit with that code itself.
+func systemdRestart(conf *Config) error {
+	// the service manager restart the service on exit even if it was not notified
+	_ = systemdNotify("STOPPING=1", "STATUS=Restarting after update")
+	if conf.ExitCallback != nil {
+		conf.ExitCallback(nil)
+		return nil
+	}
+	os.Exit(systemdExitCode(conf))
+	return nil
+}
+
+// systemdExitCode return the exit code for systemd to restart the service, 0 would stop it with Restart=on-failure
+func systemdExitCode(conf *Config) int {
+	if conf.RestartExitCode == 0 {
+		return DefaultSystemdExitCode
+	}
+	return conf.RestartExitCode
+}
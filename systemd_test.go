@@ -0,0 +1,150 @@
+//go:build !windows
+// +build !windows
+
+package selfupdate
+
+import (
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// slowSource takes its time to start the download of a testSource
+type slowSource struct {
+	*testSource
+	delay time.Duration
+}
+
+func (s *slowSource) Get(v *Version) (io.ReadCloser, int64, error) {
+	time.Sleep(s.delay)
+	return s.testSource.Get(v)
+}
+
+// fakeNotifySocket listen for the notifications of a systemd service and return them as received
+func fakeNotifySocket(t *testing.T) <-chan string {
+	path := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+
+	notifications := make(chan string, 100)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				close(notifications)
+				return
+			}
+			notifications <- string(buf[:n])
+		}
+	}()
+	return notifications
+}
+
+func TestSystemdRestart(t *testing.T) {
+	notifications := fakeNotifySocket(t)
+	t.Setenv("WATCHDOG_USEC", "20000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+
+	source, publicKey := newSignedTestSource(t, "1.2.0")
+	exited := false
+	updater := newTestUpdater(t, &Config{
+		Current:                &Version{Number: "1.0.0"},
+		Source:                 &slowSource{testSource: source, delay: 100 * time.Millisecond},
+		PublicKey:              publicKey,
+		RestartStrategy:        RestartSystemd,
+		RestartConfirmCallback: func() bool { return true },
+		ExitCallback:           func(err error) { exited = err == nil },
+	})
+
+	assert.Nil(t, updater.CheckNow())
+	assert.True(t, exited)
+
+	var received []string
+	watchdog := 0
+	for len(received) < 3 {
+		select {
+		case n := <-notifications:
+			if n == "WATCHDOG=1" {
+				watchdog++
+				continue
+			}
+			received = append(received, n)
+		case <-time.After(time.Second):
+			t.Fatalf("missing notifications, received %q", received)
+		}
+	}
+	assert.Equal(t, []string{
+		"RELOADING=1\nSTATUS=Updating to 1.2.0",
+		"READY=1\nSTATUS=",
+		"STOPPING=1\nSTATUS=Restarting after update",
+	}, received)
+	// fed every 10ms during the download
+	assert.GreaterOrEqual(t, watchdog, 5)
+}
+
+func TestSystemdNotRunning(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	assert.False(t, systemdRunning())
+	assert.Nil(t, systemdNotify("READY=1"))
+
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", "1")
+	assert.Zero(t, systemdWatchdog())
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	assert.Equal(t, 30*time.Second, systemdWatchdog())
+}
+
+func TestSystemdUpdateFailed(t *testing.T) {
+	notifications := fakeNotifySocket(t)
+
+	source, publicKey := newSignedTestSource(t, "1.2.0")
+	source.signature[0] ^= 0xff
+	updater := newTestUpdater(t, &Config{
+		Current:         &Version{Number: "1.0.0"},
+		Source:          source,
+		PublicKey:       publicKey,
+		RestartStrategy: RestartSystemd,
+		ExitCallback:    func(error) { t.Error("exited after a failed update") },
+	})
+
+	assert.NotNil(t, updater.CheckNow())
+	assert.Equal(t, "RELOADING=1\nSTATUS=Updating to 1.2.0", <-notifications)
+	assert.Equal(t, "READY=1\nSTATUS=", <-notifications)
+}
+
+// TestSystemdExitCodeHelper is run as a child process by TestSystemdExitCode, it restart like a
+// systemd service with the exit code given
+func TestSystemdExitCodeHelper(t *testing.T) {
+	code := os.Getenv("SELFUPDATE_TEST_EXIT_CODE")
+	if code == "" {
+		t.Skip("only run by TestSystemdExitCode")
+	}
+	exitCode, _ := strconv.Atoi(code)
+	systemdRestart(&Config{RestartStrategy: RestartSystemd, RestartExitCode: exitCode})
+	t.Fatal("not exited")
+}
+
+func TestSystemdExitCode(t *testing.T) {
+	for code, expected := range map[string]int{"0": DefaultSystemdExitCode, "3": 3} {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestSystemdExitCodeHelper$")
+		cmd.Env = append(os.Environ(), "SELFUPDATE_TEST_EXIT_CODE="+code, "NOTIFY_SOCKET="+filepath.Join(t.TempDir(), "missing"))
+		err := cmd.Run()
+
+		var exitErr *exec.ExitError
+		if assert.ErrorAs(t, err, &exitErr) {
+			assert.Equal(t, expected, exitErr.ExitCode())
+		}
+	}
+}
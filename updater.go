@@ -3,7 +3,9 @@ package selfupdate
 import (
 	"crypto/ed25519"
 	"errors"
+	"fmt"
 	"io"
+	"log/slog"
 	"sync"
 	"time"
 )
@@ -17,11 +19,74 @@ type Config struct {
 	Source    Source            // Necessary Source for update
 	Schedule  Schedule          // Define when to trigger an update
 	PublicKey ed25519.PublicKey // The public key that match the private key used to generate the signature of future update
+	Logger    *slog.Logger      // If present will receive structured log of the update process, otherwise LogError, LogInfo and LogDebug are used
+	Observer  Observer          // If present will receive the events of the update process, more can be added with Updater.AddObserver
+	Clock     Clock             // If present will provide the time to the scheduler, otherwise the system clock is used
+	StatePath string            // Path of the JSON file persisting the updater state across restarts, selfupdate/${executable}.json under the user config directory if not set
+
+	MandatoryPolicy     MandatoryPolicy // Define how the user confirmation is handled for a critical update or when the current version is no longer supported
+	DeclineDelay        time.Duration   // Delay before asking again for an update the user declined, DefaultDeclineDelay if not set and no delay if negative
+	RestartStrategy     RestartStrategy // Define how the application is restarted after an update, RestartFork if not set
+	RestartExitCode     int             // Exit code of RestartExit and RestartSystemd, for example a non zero one for a systemd service with Restart=on-failure, DefaultSystemdExitCode if not set with RestartSystemd
+	RestartReadyTimeout time.Duration   // Maximum delay for the new process to call Ready with RestartGraceful, DefaultRestartReadyTimeout if not set
+
+	ProgressCallback           func(float64, error)               // if present will call back with 0.0 at the start, rising through to 1.0 at the end if the progress is known. A negative start number will be sent if size is unknown, any error will pass as is and the process is considered done
+	ProgressInfoCallback       func(Progress, error)              // if present will call back with the phase, bytes processed, rate and ETA of each phase of the update, any error will pass as is and the process is considered done
+	ProgressInterval           time.Duration                      // Minimum delay between two progress call back, DefaultProgressInterval if not set and no limit if negative
+	RestartConfirmCallback     func() bool                        // if present will ask for user acceptance before restarting app, or before starting the new version after ApplyOnExit
+	UpgradeConfirmCallback     func(string) bool                  // if present will ask for user acceptance, it can present the message passed
+	UpgradeInfoCallback        func(*UpgradeInfo) bool            // if present will ask for user acceptance with the details of the update, it takes precedence over UpgradeConfirmCallback
+	UpgradeDecisionCallback    func(*UpgradeInfo) UpgradeDecision // if present will ask the user what to do with the update: install it now or on exit, be reminded later or skip this version. It takes precedence over UpgradeInfoCallback
+	UnsupportedVersionCallback func(current, minimum *Version)    // if present will be notified when the current version is older than the minimum version supported by the latest release
+	ExitCallback               func(error)                        // if present will be expected to handle app exit procedure, when restarting with RestartFork, RestartExit, RestartGraceful or RestartSystemd and on a signal handled by ApplyOnExitSignals. RestartExitCode is then not used, the callback should exit with it for RestartExit and RestartSystemd
+	RestartCallback            func(executable string) error      // restart the application with the new executable when RestartStrategy is RestartCustom
+}
+
+// MandatoryPolicy define how a mandatory update is confirmed
+type MandatoryPolicy int
 
-	ProgressCallback       func(float64, error) // if present will call back with 0.0 at the start, rising through to 1.0 at the end if the progress is known. A negative start number will be sent if size is unknown, any error will pass as is and the process is considered done
-	RestartConfirmCallback func() bool          // if present will ask for user acceptance before restarting app
-	UpgradeConfirmCallback func(string) bool    // if present will ask for user acceptance, it can present the message passed
-	ExitCallback           func(error)          // if present will be expected to handle app exit procedure
+const (
+	// MandatorySkipConfirm will install a mandatory update without asking for user acceptance
+	MandatorySkipConfirm MandatoryPolicy = iota
+	// MandatoryForceConfirm will still ask for user acceptance, but will install a mandatory update whatever the answer
+	MandatoryForceConfirm
+)
+
+// UpgradeReason explain why an update is being proposed
+type UpgradeReason int
+
+const (
+	// UpgradeAvailable is used when a more recent version is available
+	UpgradeAvailable UpgradeReason = iota
+	// UpgradeCritical is used when the latest release is flagged as critical
+	UpgradeCritical
+	// UpgradeUnsupported is used when the current version is older than the minimum version supported by the latest release
+	UpgradeUnsupported
+)
+
+// String return a message that can be presented to the user
+func (r UpgradeReason) String() string {
+	switch r {
+	case UpgradeCritical:
+		return "Critical update found"
+	case UpgradeUnsupported:
+		return "Current version is no longer supported, update required"
+	default:
+		return "New version found"
+	}
+}
+
+// UpgradeInfo describe the update being proposed to the user. Size, ReleaseNotes and
+// PublishedAt are only filled when the Source does provide them.
+type UpgradeInfo struct {
+	Reason       UpgradeReason // Why this update is proposed
+	Mandatory    bool          // If true, the update will be installed even if the user decline it
+	Critical     bool          // If the release is flagged as critical
+	Current      *Version      // The version currently running
+	Latest       *Version      // The version that will be installed
+	Size         int64         // Size of the download in bytes, 0 if unknown
+	ReleaseNotes string        // Release notes in markdown
+	PublishedAt  time.Time     // When the release was published
 }
 
 // Repeating pattern for scheduling update at a specific time
@@ -30,25 +95,30 @@ type Repeating int
 const (
 	// None will not schedule
 	None Repeating = iota
-	// Hourly will schedule in the next hour and repeat it every hour after
+	// Hourly will schedule at the minute of the offset and repeat it every hour after
 	Hourly
-	// Daily will schedule next day and repeat it every day after
+	// Daily will schedule at the time of the day of the offset and repeat it every day after
 	Daily
-	// Monthly will schedule next month and repeat it every month after
+	// Monthly will schedule on the day of the month of the offset and repeat it every month after
 	Monthly
+	// Weekly will schedule on the day of the week of the offset and repeat it every week after
+	Weekly
 )
 
 // ScheduleAt define when a repeating update at a specific time should be triggered
 type ScheduleAt struct {
 	Repeating // The pattern to enforce for the repeating schedule
-	time.Time // Offset time used to define when in a minute/hour/day/month to actually trigger the schedule
+	time.Time // Offset time used to define when in an hour/day/week/month to actually trigger the schedule, in its location
 }
 
 // Schedule define when to trigger an update
 type Schedule struct {
-	FetchOnStart bool          // Trigger when the updater is created
-	Interval     time.Duration // Trigger at regular interval
-	At           ScheduleAt    // Trigger at a specific time
+	FetchOnStart bool                // Trigger when the updater is created
+	Interval     time.Duration       // Trigger at regular interval
+	At           ScheduleAt          // Trigger at a specific time
+	Cron         string              // Trigger when the cron expression "minute hour day-of-month month day-of-week" match, in the local time unless prefixed by CRON_TZ=Location
+	Jitter       time.Duration       // Delay each trigger by a random duration up to Jitter, so that a fleet of applications does not check at once
+	Windows      []MaintenanceWindow // If present, an update found outside of these windows is downloaded, but only installed once one opens
 }
 
 // Version define an executable versionning information
@@ -56,6 +126,13 @@ type Version struct {
 	Number string    // if the app knows its version and supports checking metadata
 	Build  int       // if the app has a build number this could be compared
 	Date   time.Time // last update, could be mtime
+
+	Critical     bool     // if the release metadata flag this version as a mandatory update
+	Minimum      *Version // if the release metadata define the oldest version still supported, older one will have to update
+	Size         int64    // if the source knows the size of the download
+	ReleaseNotes string   // if the release metadata provide release notes, in markdown
+	ETag         string   // if the source serve the release with an entity tag
+	Rollback     bool     // if the source designate a previous release to return to, it is installed over a newer version
 }
 
 // Updater is managing update for your application in the background
@@ -63,6 +140,16 @@ type Updater struct {
 	lock       sync.Mutex
 	conf       *Config
 	executable string
+	target     string // path of the file to update, empty for the running executable
+
+	observersLock sync.Mutex
+	observers     []Observer
+
+	statusLock sync.Mutex // held independently of lock, so that Status does not wait for a check
+	status     Status
+
+	stateOnce sync.Once
+	state     *stateStore
 }
 
 // CheckNow will manually trigger a check of an update and if one is present will start the update process
@@ -70,83 +157,272 @@ func (u *Updater) CheckNow() error {
 	u.lock.Lock()
 	defer u.lock.Unlock()
 
+	log := u.logger().With("source", fmt.Sprintf("%T", u.conf.Source))
+
+	current, latest, action, err := u.check(log)
+	if err != nil || latest == nil {
+		return err
+	}
+	if action == ActionInstallOnExit {
+		return u.stage(log, current, latest)
+	}
+
+	ready := u.systemdReloading(log, latest)
+	err = u.update(log, current, latest)
+	ready()
+	if err != nil {
+		if errors.Is(err, ErrNoUpdate) {
+			return nil
+		}
+		return err
+	}
+	return u.restartAfterUpdate(log, latest)
+}
+
+// check return the current version and, if an update was found and confirmed, the latest version
+// along with what the user decided to do with it
+func (u *Updater) check(log *slog.Logger) (*Version, *Version, UpgradeAction, error) {
 	v := u.conf.Current
 	if v == nil {
 		mtime, err := lastModifiedExecutable()
 		if err != nil {
-			return err
+			log.Error("Unable to get the executable modification time", "error", err)
+			u.emit(EventCheckFailed, nil, err)
+			return nil, nil, 0, err
 		}
 
 		v = &Version{Date: mtime.In(time.UTC)}
 	}
 
+	log.Debug("Checking for update", "version", v)
+	u.emit(EventCheckStarted, v, nil)
+	start := time.Now()
 	latest, err := u.conf.Source.LatestVersion()
+	if errors.Is(err, ErrNoUpdate) {
+		log.Debug("The source reported no update", "version", v, "duration", time.Since(start))
+		u.emit(EventNoUpdate, v, nil)
+		return v, nil, 0, nil
+	}
 	if err != nil {
-		return err
+		log.Error("Unable to get the latest version", "error", err, "duration", time.Since(start))
+		u.emit(EventCheckFailed, v, err)
+		return v, nil, 0, err
+	}
+
+	info := newUpgradeInfo(v, latest)
+	if info.Reason == UpgradeUnsupported {
+		log.Info("Local version is older than the minimum version supported", "version", v, "minimum", latest.Minimum)
+		if notify := u.conf.UnsupportedVersionCallback; notify != nil {
+			notify(v, latest.Minimum)
+		}
+	}
+
+	if !isNewer(v, latest) {
+		log.Debug("Local version is recent enough compared to the online version", "version", v, "latest", latest, "duration", time.Since(start))
+		u.emit(EventNoUpdate, latest, nil)
+		return v, nil, 0, nil
+	}
+	if reason := u.skipVersion(info); reason != "" {
+		log.Info("Skipping the latest version", "latest", latest, "reason", reason)
+		u.emit(EventNoUpdate, latest, nil)
+		return v, nil, 0, nil
 	}
-	if !latest.Date.After(v.Date) {
-		logDebug("Local binary time (%v) is recent enough compared to the online version (%v).\n", v.Date.Format(time.RFC1123Z), latest.Date.Format(time.RFC1123Z))
-		return nil
+	u.emit(EventUpdateFound, latest, nil)
+
+	decision := u.confirmUpgrade(info)
+	u.recordDecision(latest, decision)
+	if decision.Action == ActionRemindLater || decision.Action == ActionSkipVersion {
+		log.Info("The user didn't confirm the upgrade", "latest", latest, "decision", decision.Action.String())
+		u.emit(EventUpdateDeclined, latest, nil)
+		return v, nil, decision.Action, nil
 	}
+	return v, latest, decision.Action, nil
+}
 
-	if ask := u.conf.UpgradeConfirmCallback; ask != nil {
-		if !ask("New version found") {
-			logInfo("The user didn't confirm the upgrade.\n")
+// restartAfterUpdate restart the application once the user confirmed it if asked to
+func (u *Updater) restartAfterUpdate(log *slog.Logger, latest *Version) error {
+	if ask := u.conf.RestartConfirmCallback; ask != nil {
+		if !ask() {
+			log.Info("The user didn't confirm restarting the application after upgrade")
+			u.emit(EventRestartPending, latest, nil)
 			return nil
 		}
 	}
+	return u.Restart()
+}
 
-	s, err := u.conf.Source.GetSignature()
+// update download, verify and install the latest version
+func (u *Updater) update(log *slog.Logger, current *Version, latest *Version) error {
+	opts, newBytes, err := u.download(log, current, latest)
 	if err != nil {
 		return err
 	}
+	return u.install(log, opts, newBytes, current, latest)
+}
 
-	r, contentLength, err := u.conf.Source.Get(v)
+// download the latest version and verify its signature
+func (u *Updater) download(log *slog.Logger, current *Version, latest *Version) (*Options, []byte, error) {
+	u.emit(EventDownloadStarted, latest, nil)
+	defer u.feedWatchdog()()
+
+	s, err := u.conf.Source.GetSignature()
 	if err != nil {
-		return err
+		log.Error("Unable to get the signature", "latest", latest, "error", err)
+		u.emit(EventDownloadFailed, latest, err)
+		return nil, nil, err
+	}
+
+	start := time.Now()
+	r, contentLength, err := u.conf.Source.Get(current)
+	if errors.Is(err, ErrNoUpdate) {
+		log.Debug("The source reported no update on download", "latest", latest)
+		u.emit(EventNoUpdate, latest, nil)
+		return nil, nil, err
+	}
+	if err != nil {
+		log.Error("Unable to download the update", "latest", latest, "error", err)
+		u.emit(EventDownloadFailed, latest, err)
+		return nil, nil, err
 	}
 	defer r.Close()
 
-	pr := &progressReader{Reader: r, progressCallback: u.conf.ProgressCallback, contentLength: contentLength}
+	reporter := newProgressReporter(u.conf, u.recordProgress)
+	pr := &progressReader{Reader: r, reporter: reporter, contentLength: contentLength}
+
+	opts := &Options{TargetPath: u.target, PublicKey: u.conf.PublicKey, Signature: s[:]}
+	if err = opts.prepare(); err != nil {
+		log.Error("Unable to prepare the update", "error", err)
+		u.emit(EventInstallFailed, latest, err)
+		return nil, nil, newApplyError(StagePrepare, err)
+	}
 
-	u.executable, err = applyUpdate(pr, u.conf.PublicKey, s)
+	newBytes, err := opts.readUpdate(pr)
 	if err != nil {
-		return err
+		log.Error("Unable to download the update", "latest", latest, "bytes", pr.downloaded, "duration", time.Since(start), "error", err)
+		u.emit(EventDownloadFailed, latest, err)
+		return nil, nil, newApplyError(StageRead, err)
+	}
+	log.Debug("Update downloaded", "latest", latest, "bytes", pr.downloaded, "duration", time.Since(start))
+	u.emit(EventDownloadCompleted, latest, nil)
+
+	size := int64(len(newBytes))
+	reporter.report(PhaseVerify, 0, size, nil)
+	if err = opts.verify(newBytes); err != nil {
+		log.Error("Unable to verify the update", "latest", latest, "error", err)
+		reporter.report(PhaseVerify, 0, size, err)
+		u.emit(EventVerificationFailed, latest, err)
+		return nil, nil, newApplyError(StageVerify, err)
 	}
+	reporter.report(PhaseVerify, size, size, nil)
+	u.emit(EventVerificationPassed, latest, nil)
+	return opts, newBytes, nil
+}
 
-	if ask := u.conf.RestartConfirmCallback; ask != nil {
-		if !ask() {
-			logInfo("The user didn't confirm restarting the application after upgrade.\n")
-			return nil
+// install the verified executable in place of the target, any update staged before is discarded
+func (u *Updater) install(log *slog.Logger, opts *Options, newBytes []byte, current *Version, latest *Version) error {
+	reporter := newProgressReporter(u.conf, u.recordProgress)
+	size := int64(len(newBytes))
+	start := time.Now()
+
+	reporter.report(PhaseInstall, 0, size, nil)
+	if err := opts.install(newBytes); err != nil {
+		log.Error("Unable to install the update", "latest", latest, "error", err)
+		reporter.report(PhaseInstall, 0, size, err)
+		var rerr *rollbackErr
+		if errors.As(err, &rerr) {
+			u.emit(EventRollback, latest, rerr.rollbackErr)
 		}
+		u.emit(EventInstallFailed, latest, err)
+		return newApplyError(StageInstall, err)
 	}
-	return u.Restart()
+	reporter.report(PhaseInstall, size, size, nil)
+	u.executable = opts.TargetPath
+	removeStaged(opts.TargetPath)
+
+	if recorder, ok := u.conf.Source.(InstallRecorder); ok {
+		if err := recorder.RecordInstall(latest); err != nil {
+			log.Warn("Unable to record the installed version in the source", "latest", latest, "error", err)
+		}
+	}
+
+	log.Info("Update applied", "version", current, "latest", latest, "bytes", size, "duration", time.Since(start))
+	u.emit(EventInstalled, latest, nil)
+	return nil
+}
+
+// isNewer compare version number when both are known and the date of the executable otherwise.
+// A rollback is newer than any other version number, as the date of a rollback is the one it was
+// decided at.
+func isNewer(current *Version, latest *Version) bool {
+	if current.Number != "" && latest.Number != "" {
+		if latest.Rollback {
+			return compareVersionNumber(current.Number, latest.Number) != 0
+		}
+		return current.Before(latest)
+	}
+	return latest.Date.After(current.Date)
+}
+
+func newUpgradeInfo(current *Version, latest *Version) *UpgradeInfo {
+	info := &UpgradeInfo{
+		Reason:       UpgradeAvailable,
+		Critical:     latest.Critical,
+		Current:      current,
+		Latest:       latest,
+		Size:         latest.Size,
+		ReleaseNotes: latest.ReleaseNotes,
+		PublishedAt:  latest.Date,
+	}
+
+	switch {
+	case latest.Minimum != nil && current.Before(latest.Minimum):
+		info.Reason = UpgradeUnsupported
+		info.Mandatory = true
+	case latest.Critical:
+		info.Reason = UpgradeCritical
+		info.Mandatory = true
+	}
+	return info
+}
+
+// confirmUpgrade ask the user what to do with the update, a mandatory update being installed unless
+// the user decided to install it on exit
+func (u *Updater) confirmUpgrade(info *UpgradeInfo) UpgradeDecision {
+	if info.Mandatory && u.conf.MandatoryPolicy == MandatorySkipConfirm {
+		u.logger().Info("Mandatory upgrade, skipping user confirmation", "reason", info.Reason.String())
+		return UpgradeDecision{Action: ActionInstallNow}
+	}
+
+	decision := UpgradeDecision{Action: ActionInstallNow}
+	if ask := u.conf.UpgradeDecisionCallback; ask != nil {
+		decision = ask(info)
+	} else if ask := u.conf.UpgradeInfoCallback; ask != nil {
+		decision = decisionOf(ask(info))
+	} else if ask := u.conf.UpgradeConfirmCallback; ask != nil {
+		decision = decisionOf(ask(info.Reason.String()))
+	}
+
+	if info.Mandatory && (decision.Action == ActionRemindLater || decision.Action == ActionSkipVersion) {
+		u.logger().Info("The user didn't confirm the upgrade, but it is mandatory", "reason", info.Reason.String())
+		return UpgradeDecision{Action: ActionInstallNow}
+	}
+	return decision
 }
 
-// Restart once an update is done can trigger a restart of the binary. This is useful to implement a restart later policy.
+// Restart once an update is done can trigger a restart of the binary according to Config.RestartStrategy. This is useful to implement a restart later policy.
 func (u *Updater) Restart() error {
-	return restart(u.conf.ExitCallback, u.executable)
+	return restart(u.conf, u.executable)
 }
 
 // Manage sets up an Updater and runs it to manage the current executable.
 func Manage(conf *Config) (*Updater, error) {
 	updater := &Updater{conf: conf}
 
-	go func() {
-		if updater.conf.Schedule.FetchOnStart {
-			logInfo("Doing an initial upgrade check.\n")
-			err := updater.CheckNow()
-			if err != nil {
-				logError("Upgrade error: %v\n", err)
-			}
-		}
-
-		if updater.conf.Schedule.Interval != 0 || updater.conf.Schedule.At.Repeating != None {
-			go func() {
-				triggerSchedule(updater)
-			}()
-		}
-	}()
+	s, err := newScheduler(updater)
+	if err != nil {
+		return nil, err
+	}
+	go s.run()
 
 	// TODO check if we can support the current app!
 	return updater, nil
@@ -180,42 +456,3 @@ func applyUpdate(r io.Reader, publicKey ed25519.PublicKey, signature [64]byte) (
 	}
 	return opts.TargetPath, nil
 }
-
-func triggerSchedule(updater *Updater) {
-	for {
-		var delay time.Duration
-
-		if updater.conf.Schedule.Interval != 0 {
-			delay = updater.conf.Schedule.Interval
-		}
-		if updater.conf.Schedule.At.Repeating != None {
-			at := delayUntilNextTriggerAt(updater.conf.Schedule.At.Repeating, updater.conf.Schedule.At.Time)
-			if delay == 0 || at < delay {
-				delay = at
-			}
-		}
-
-		time.Sleep(delay)
-		logInfo("Scheduled upgrade check after %s.\n", delay)
-		err := updater.CheckNow()
-		if err != nil {
-			logError("Upgrade error: %v\n", err)
-		}
-	}
-}
-
-func delayUntilNextTriggerAt(repeating Repeating, offset time.Time) time.Duration {
-	now := time.Now().In(offset.Location())
-	month, day, hour := now.Month(), now.Day(), now.Hour()
-	switch repeating {
-	case Monthly:
-		month++
-	case Daily:
-		day++
-	case Hourly:
-		hour++
-	}
-
-	next := time.Date(now.Year(), month, day, hour, offset.Minute(), offset.Second(), offset.Nanosecond(), offset.Location())
-	return next.Sub(now)
-}
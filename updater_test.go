@@ -1,28 +1,79 @@
 package selfupdate
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
+type testSource struct {
+	version   *Version
+	content   []byte
+	signature [64]byte
+	err       error
+}
+
+func (s *testSource) Get(*Version) (io.ReadCloser, int64, error) {
+	if s.err != nil {
+		return nil, 0, s.err
+	}
+	return io.NopCloser(bytes.NewReader(s.content)), int64(len(s.content)), nil
+}
+
+func (s *testSource) GetSignature() ([64]byte, error) {
+	return s.signature, s.err
+}
+
+func newSignedTestSource(t *testing.T, number string) (*testSource, ed25519.PublicKey) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+
+	source := &testSource{version: &Version{Number: number}, content: newFile}
+	copy(source.signature[:], ed25519.Sign(privateKey, newFile))
+	return source, publicKey
+}
+
+func newTestUpdater(t *testing.T, conf *Config) *Updater {
+	target := filepath.Join(t.TempDir(), "app")
+	writeOldFile(target, t)
+
+	if conf.RestartConfirmCallback == nil {
+		conf.RestartConfirmCallback = func() bool { return false }
+	}
+	if conf.StatePath == "" {
+		conf.StatePath = filepath.Join(t.TempDir(), "state.json")
+	}
+	return &Updater{conf: conf, target: target}
+}
+
+func (s *testSource) LatestVersion() (*Version, error) {
+	return s.version, s.err
+}
+
 func Test_DelayUntilNextTriggerAt(t *testing.T) {
 	now := time.Now()
 
-	hourly := delayUntilNextTriggerAt(Hourly, time.Date(0, 0, 0, 0, 42, 7, 9990000, time.Local))
+	hourly := nextTriggerAt(Hourly, time.Date(0, 0, 0, 0, 42, 7, 9990000, time.Local), now).Sub(now)
 	hourlyTime := now.Add(hourly)
 	maxHour := now.Add(2 * time.Hour)
 	assert.Greater(t, hourlyTime.UnixNano(), now.UnixNano())
 	assert.Less(t, hourlyTime.UnixNano(), maxHour.UnixNano())
 
-	daily := delayUntilNextTriggerAt(Daily, time.Date(0, 0, 0, 3, 42, 7, 9990000, time.Local))
+	daily := nextTriggerAt(Daily, time.Date(0, 0, 0, 3, 42, 7, 9990000, time.Local), now).Sub(now)
 	dailyTime := now.Add(daily)
 	maxDay := now.Add(48 * time.Hour)
 	assert.Greater(t, dailyTime.UnixNano(), now.UnixNano())
 	assert.Less(t, dailyTime.UnixNano(), maxDay.UnixNano())
 
-	monthly := delayUntilNextTriggerAt(Monthly, time.Date(0, 0, 0, 0, 42, 7, 9990000, time.Local))
+	monthly := nextTriggerAt(Monthly, time.Date(0, 0, 0, 0, 42, 7, 9990000, time.Local), now).Sub(now)
 	t.Log(monthly)
 	monthlyTime := now.Add(monthly)
 	maxMonth := now.Add(2 * 31 * 24 * time.Hour)
@@ -33,10 +84,181 @@ func Test_DelayUntilNextTriggerAt(t *testing.T) {
 func Test_DelayUntilNextTriggerAtDifferentLocatrion(t *testing.T) {
 	now := time.Now()
 
-	hourly := delayUntilNextTriggerAt(Hourly, time.Date(0, 0, 0, 0, 42, 7, 9990000, time.UTC))
+	hourly := nextTriggerAt(Hourly, time.Date(0, 0, 0, 0, 42, 7, 9990000, time.UTC), now).Sub(now)
 	t.Log(hourly)
 	hourlyTime := now.Add(hourly)
 	maxHour := now.Add(2 * time.Hour)
 	assert.Greater(t, hourlyTime.UnixNano(), now.UnixNano())
 	assert.Less(t, hourlyTime.UnixNano(), maxHour.UnixNano())
 }
+
+func TestNewUpgradeInfo(t *testing.T) {
+	current := &Version{Number: "1.0.0"}
+
+	info := newUpgradeInfo(current, &Version{Number: "1.1.0"})
+	assert.Equal(t, UpgradeAvailable, info.Reason)
+	assert.False(t, info.Mandatory)
+
+	published := time.Date(2022, 6, 22, 10, 0, 0, 0, time.UTC)
+	info = newUpgradeInfo(current, &Version{Number: "1.1.0", Date: published, Critical: true, Size: 42, ReleaseNotes: "- fix"})
+	assert.Equal(t, UpgradeCritical, info.Reason)
+	assert.True(t, info.Mandatory)
+	assert.True(t, info.Critical)
+	assert.Equal(t, int64(42), info.Size)
+	assert.Equal(t, "- fix", info.ReleaseNotes)
+	assert.Equal(t, published, info.PublishedAt)
+	assert.Equal(t, "1.1.0", info.Latest.Number)
+
+	info = newUpgradeInfo(current, &Version{Number: "1.1.0", Minimum: &Version{Number: "1.0.1"}})
+	assert.Equal(t, UpgradeUnsupported, info.Reason)
+	assert.True(t, info.Mandatory)
+	assert.Equal(t, current, info.Current)
+
+	info = newUpgradeInfo(current, &Version{Number: "1.1.0", Minimum: &Version{Number: "1.0.0"}})
+	assert.Equal(t, UpgradeAvailable, info.Reason)
+}
+
+func TestConfirmUpgrade(t *testing.T) {
+	var messages []string
+	var infos []*UpgradeInfo
+	u := &Updater{conf: &Config{
+		UpgradeConfirmCallback: func(msg string) bool {
+			messages = append(messages, msg)
+			return false
+		},
+	}}
+
+	assert.Equal(t, ActionRemindLater, u.confirmUpgrade(&UpgradeInfo{Reason: UpgradeAvailable}).Action)
+	assert.Equal(t, ActionInstallNow, u.confirmUpgrade(&UpgradeInfo{Reason: UpgradeCritical, Mandatory: true}).Action)
+	assert.Equal(t, []string{"New version found"}, messages)
+
+	u.conf.MandatoryPolicy = MandatoryForceConfirm
+	assert.Equal(t, ActionInstallNow, u.confirmUpgrade(&UpgradeInfo{Reason: UpgradeUnsupported, Mandatory: true}).Action)
+	assert.Equal(t, []string{"New version found", UpgradeUnsupported.String()}, messages)
+
+	u.conf.UpgradeInfoCallback = func(info *UpgradeInfo) bool {
+		infos = append(infos, info)
+		return true
+	}
+	assert.Equal(t, ActionInstallNow, u.confirmUpgrade(&UpgradeInfo{Reason: UpgradeAvailable}).Action)
+	assert.Len(t, infos, 1)
+	assert.Len(t, messages, 2)
+}
+
+func TestCheckNowEvents(t *testing.T) {
+	source, publicKey := newSignedTestSource(t, "1.1.0")
+
+	var events []Event
+	u := newTestUpdater(t, &Config{
+		Current:   &Version{Number: "1.0.0"},
+		Source:    source,
+		PublicKey: publicKey,
+		Observer:  ObserverFunc(func(e Event) { events = append(events, e) }),
+	})
+	var kinds []EventKind
+	u.AddObserver(ObserverFunc(func(e Event) { kinds = append(kinds, e.Kind) }))
+
+	assert.Nil(t, u.CheckNow())
+	assert.Equal(t, []EventKind{
+		EventCheckStarted, EventUpdateFound, EventDownloadStarted, EventDownloadCompleted,
+		EventVerificationPassed, EventInstalled, EventRestartPending,
+	}, kinds)
+	assert.Len(t, events, len(kinds))
+	assert.Equal(t, "1.1.0", events[len(events)-1].Version.Number)
+	assert.False(t, events[0].Time.IsZero())
+
+	content, err := os.ReadFile(u.target)
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, content)
+
+	kinds = nil
+	source.signature[0]++
+	writeOldFile(u.target, t)
+	err = u.CheckNow()
+	assert.True(t, errors.Is(err, ErrSignatureInvalid))
+	assert.Equal(t, EventVerificationFailed, kinds[len(kinds)-1])
+	assert.NotNil(t, events[len(events)-1].Err)
+
+	kinds = nil
+	source.version = &Version{Number: "1.0.0"}
+	assert.Nil(t, u.CheckNow())
+	assert.Equal(t, []EventKind{EventCheckStarted, EventNoUpdate}, kinds)
+
+	kinds = nil
+	source.err = ErrNoUpdate
+	assert.Nil(t, u.CheckNow())
+	assert.Equal(t, []EventKind{EventCheckStarted, EventNoUpdate}, kinds)
+
+	kinds = nil
+	source.err = errors.New("unreachable")
+	assert.NotNil(t, u.CheckNow())
+	assert.Equal(t, []EventKind{EventCheckStarted, EventCheckFailed}, kinds)
+	assert.Equal(t, source.err, events[len(events)-1].Err)
+}
+
+func TestCheckNowDeclined(t *testing.T) {
+	source, publicKey := newSignedTestSource(t, "1.1.0")
+
+	var kinds []EventKind
+	u := newTestUpdater(t, &Config{
+		Current:                &Version{Number: "1.0.0"},
+		Source:                 source,
+		PublicKey:              publicKey,
+		UpgradeConfirmCallback: func(string) bool { return false },
+		Observer:               ObserverFunc(func(e Event) { kinds = append(kinds, e.Kind) }),
+	})
+
+	assert.Nil(t, u.CheckNow())
+	assert.Equal(t, []EventKind{EventCheckStarted, EventUpdateFound, EventUpdateDeclined}, kinds)
+	assert.Equal(t, "update_declined", EventUpdateDeclined.String())
+}
+
+func TestCheckNowRollback(t *testing.T) {
+	source, publicKey := newSignedTestSource(t, "1.1.0")
+
+	var kinds []EventKind
+	u := newTestUpdater(t, &Config{
+		Current:   &Version{Number: "1.2.0"},
+		Source:    source,
+		PublicKey: publicKey,
+		Observer:  ObserverFunc(func(e Event) { kinds = append(kinds, e.Kind) }),
+	})
+
+	// an older version is not an update
+	assert.Nil(t, u.CheckNow())
+	assert.Equal(t, []EventKind{EventCheckStarted, EventNoUpdate}, kinds)
+
+	// unless the source designate it as a rollback
+	kinds = nil
+	source.version.Rollback = true
+	assert.Nil(t, u.CheckNow())
+	assert.Contains(t, kinds, EventInstalled)
+	content, err := os.ReadFile(u.target)
+	assert.Nil(t, err)
+	assert.Equal(t, newFile, content)
+
+	// which is not installed again once running
+	kinds = nil
+	u.conf.Current = &Version{Number: "1.1.0"}
+	assert.Nil(t, u.CheckNow())
+	assert.Equal(t, []EventKind{EventCheckStarted, EventNoUpdate}, kinds)
+}
+
+func TestCheckNowProgress(t *testing.T) {
+	source, publicKey := newSignedTestSource(t, "1.1.0")
+
+	var phases []ProgressPhase
+	var fractions []float64
+	u := newTestUpdater(t, &Config{
+		Current:              &Version{Number: "1.0.0"},
+		Source:               source,
+		PublicKey:            publicKey,
+		ProgressCallback:     func(f float64, err error) { fractions = append(fractions, f) },
+		ProgressInfoCallback: func(p Progress, err error) { phases = append(phases, p.Phase) },
+	})
+
+	assert.Nil(t, u.CheckNow())
+	assert.Equal(t, float64(1), fractions[len(fractions)-1])
+	assert.Equal(t, PhaseDownload, phases[0])
+	assert.Equal(t, []ProgressPhase{PhaseVerify, PhaseVerify, PhaseInstall, PhaseInstall}, phases[len(phases)-4:])
+}
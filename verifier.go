@@ -5,7 +5,7 @@ import (
 	"crypto/ecdsa"
 	"crypto/rsa"
 	"encoding/asn1"
-	"errors"
+	"fmt"
 	"math/big"
 )
 
@@ -25,7 +25,7 @@ func NewRSAVerifier() Verifier {
 	return verifyFn(func(checksum, signature []byte, hash crypto.Hash, publicKey crypto.PublicKey) error {
 		key, ok := publicKey.(*rsa.PublicKey)
 		if !ok {
-			return errors.New("not a valid RSA public key")
+			return fmt.Errorf("%w: not a valid RSA public key", ErrInvalidPublicKey)
 		}
 		return rsa.VerifyPKCS1v15(key, hash, checksum, signature)
 	})
@@ -41,14 +41,14 @@ func NewECDSAVerifier() Verifier {
 	return verifyFn(func(checksum, signature []byte, hash crypto.Hash, publicKey crypto.PublicKey) error {
 		key, ok := publicKey.(*ecdsa.PublicKey)
 		if !ok {
-			return errors.New("not a valid ECDSA public key")
+			return fmt.Errorf("%w: not a valid ECDSA public key", ErrInvalidPublicKey)
 		}
 		var rs rsDER
 		if _, err := asn1.Unmarshal(signature, &rs); err != nil {
-			return err
+			return fmt.Errorf("%w: %w", ErrSignatureMalformed, err)
 		}
 		if !ecdsa.Verify(key, checksum, rs.R, rs.S) {
-			return errors.New("failed to verify ecsda signature")
+			return fmt.Errorf("%w: failed to verify ecsda signature", ErrSignatureInvalid)
 		}
 		return nil
 	})
@@ -0,0 +1,125 @@
+package selfupdate
+
+import (
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// Before reports whether v is an older version than o. Version numbers are compared
+// when both are known, otherwise build numbers and finally dates are used. If none of
+// them are available on both side, the versions are not considered comparable and
+// Before returns false.
+func (v *Version) Before(o *Version) bool {
+	if v == nil || o == nil {
+		return false
+	}
+
+	switch {
+	case v.Number != "" && o.Number != "":
+		return compareVersionNumber(v.Number, o.Number) < 0
+	case v.Build != 0 && o.Build != 0:
+		return v.Build < o.Build
+	case !v.Date.IsZero() && !o.Date.IsZero():
+		return v.Date.Before(o.Date)
+	}
+	return false
+}
+
+// LogValue implements slog.LogValuer and only log the known information of a Version
+func (v *Version) LogValue() slog.Value {
+	if v == nil {
+		return slog.Value{}
+	}
+
+	attrs := []slog.Attr{}
+	if v.Number != "" {
+		attrs = append(attrs, slog.String("number", v.Number))
+	}
+	if v.Build != 0 {
+		attrs = append(attrs, slog.Int("build", v.Build))
+	}
+	if !v.Date.IsZero() {
+		attrs = append(attrs, slog.Time("date", v.Date))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// compareVersionNumber compares dotted version numbers like 1.2.10 or v1.3.0-rc1, numeric parts
+// are compared as number and any other part as string. A missing part is 0, so that 1.2 is the same
+// as 1.2.0, a pre-release is older than the release and a +build metadata is ignored, like in semver.
+func compareVersionNumber(a, b string) int {
+	coreA, preA := splitVersionNumber(a)
+	coreB, preB := splitVersionNumber(b)
+
+	if c := compareVersionParts(coreA, coreB, "0"); c != 0 {
+		return c
+	}
+	switch {
+	case len(preA) == 0 && len(preB) == 0:
+		return 0
+	case len(preA) == 0:
+		return 1
+	case len(preB) == 0:
+		return -1
+	}
+	// rc.1 is older than rc.1.1
+	return compareVersionParts(preA, preB, "")
+}
+
+// compareVersionParts compares the parts one by one, a missing part being replaced by missing
+func compareVersionParts(pa, pb []string, missing string) int {
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		ca, cb := missing, missing
+		if i < len(pa) {
+			ca = pa[i]
+		}
+		if i < len(pb) {
+			cb = pb[i]
+		}
+
+		na, errA := strconv.Atoi(ca)
+		nb, errB := strconv.Atoi(cb)
+		switch {
+		case ca == cb:
+			continue
+		case errA == nil && errB == nil:
+			if na == nb {
+				// 01 and 1
+				continue
+			}
+			if na < nb {
+				return -1
+			}
+			return 1
+		case ca == "":
+			return -1
+		case cb == "":
+			return 1
+		case errA == nil:
+			// numeric identifiers are older than alphanumeric ones
+			return -1
+		case errB == nil:
+			return 1
+		case ca < cb:
+			return -1
+		default:
+			return 1
+		}
+	}
+	return 0
+}
+
+// splitVersionNumber return the parts of the release and of the pre-release, without the build metadata
+func splitVersionNumber(n string) (core []string, pre []string) {
+	n = strings.TrimPrefix(strings.TrimSpace(n), "v")
+	n, _, _ = strings.Cut(n, "+")
+	n, prerelease, _ := strings.Cut(n, "-")
+
+	split := func(s string) []string {
+		return strings.FieldsFunc(s, func(r rune) bool {
+			return r == '.' || r == '-'
+		})
+	}
+	return split(n), split(prerelease)
+}
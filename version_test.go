@@ -0,0 +1,46 @@
+package selfupdate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareVersionNumber(t *testing.T) {
+	assert.Equal(t, 0, compareVersionNumber("1.2.3", "v1.2.3"))
+	assert.Equal(t, -1, compareVersionNumber("1.2.3", "1.2.10"))
+	assert.Equal(t, 1, compareVersionNumber("1.10.0", "1.9.9"))
+	assert.Equal(t, -1, compareVersionNumber("1.2", "1.2.1"))
+	assert.Equal(t, -1, compareVersionNumber("1.2.0-rc1", "1.2.0"))
+	assert.Equal(t, 1, compareVersionNumber("1.2.0-rc2", "1.2.0-rc1"))
+
+	// a missing part is 0
+	assert.Equal(t, 0, compareVersionNumber("1.2", "1.2.0"))
+	assert.Equal(t, 0, compareVersionNumber("v2", "2.0.0"))
+	assert.Equal(t, -1, compareVersionNumber("1.2-rc1", "1.2.0"))
+	assert.Equal(t, 1, compareVersionNumber("1.2.0", "1.2-rc1"))
+	assert.Equal(t, -1, compareVersionNumber("1.2.0-rc.1", "1.2.0-rc.1.1"))
+	assert.Equal(t, -1, compareVersionNumber("1.2.0-rc.2", "1.2.0-rc.10"))
+	assert.Equal(t, -1, compareVersionNumber("1.2.0-1", "1.2.0-alpha"))
+
+	// the build metadata is ignored
+	assert.Equal(t, 0, compareVersionNumber("1.2.0+build.5", "1.2.0"))
+	assert.Equal(t, 0, compareVersionNumber("1.2.0+20240101", "1.2.0+20230101"))
+	assert.Equal(t, -1, compareVersionNumber("1.2.0-rc1+build.9", "1.2.0+build.1"))
+	assert.Equal(t, -1, compareVersionNumber("1.2.0+999", "1.2.1"))
+
+	// a client at 1.2 is not older than a minimum of 1.2.0
+	assert.False(t, (&Version{Number: "1.2"}).Before(&Version{Number: "1.2.0"}))
+}
+
+func TestVersionBefore(t *testing.T) {
+	now := time.Now()
+
+	assert.True(t, (&Version{Number: "1.0.0"}).Before(&Version{Number: "1.1.0"}))
+	assert.False(t, (&Version{Number: "1.1.0", Build: 1}).Before(&Version{Number: "1.0.0", Build: 2}))
+	assert.True(t, (&Version{Build: 1}).Before(&Version{Number: "1.0.0", Build: 2}))
+	assert.True(t, (&Version{Date: now}).Before(&Version{Date: now.Add(time.Hour)}))
+	assert.False(t, (&Version{Number: "1.0.0"}).Before(&Version{Build: 2}))
+	assert.False(t, (*Version)(nil).Before(&Version{Build: 2}))
+}